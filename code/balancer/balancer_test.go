@@ -5,6 +5,10 @@ import (
 	"time"
 
 	"gozerosource/code/balancer"
+	"gozerosource/code/balancer/zrpc"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestP2C(t *testing.T) {
@@ -31,3 +35,21 @@ func TestP2C(t *testing.T) {
 		}
 	}
 }
+
+func TestRetryable(t *testing.T) {
+	for _, c := range []struct {
+		code codes.Code
+		want bool
+	}{
+		{codes.OK, false},
+		{codes.InvalidArgument, false},
+		{codes.ResourceExhausted, false},
+		{codes.DeadlineExceeded, true},
+		{codes.Unavailable, true},
+		{codes.Internal, true},
+	} {
+		if got := zrpc.Retryable(status.Error(c.code, "")); got != c.want {
+			t.Errorf("%v: %t; want %t", c.code, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package balancer_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"gozerosource/code/balancer"
+	"gozerosource/code/balancer/proto"
+	"gozerosource/code/balancer/zrpc"
+	"gozerosource/code/core/breaker"
+	"gozerosource/code/core/limit"
+
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/service"
+	xrate "golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryRateLimitInterceptor(t *testing.T) {
+	limiter := limit.KeyLimiterFunc(func(key string) (limit.Result, error) {
+		if key == "blocked" {
+			return limit.Result{State: limit.OverQuota, Limit: 1}, nil
+		}
+
+		return limit.Result{State: limit.Allowed, Limit: 1}, nil
+	})
+	interceptor := zrpc.UnaryRateLimitInterceptor(limiter, zrpc.MetadataRateLimitKey("tenant"))
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Test/Call"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+
+	for tenant, want := range map[string]codes.Code{
+		"":        codes.OK,
+		"allowed": codes.OK,
+		"blocked": codes.ResourceExhausted,
+	} {
+		ctx := context.Background()
+		if len(tenant) > 0 {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("tenant", tenant))
+		}
+		_, err := interceptor(ctx, nil, info, handler)
+		if code := status.Code(err); code != want {
+			t.Errorf("tenant %q: %v; want %v", tenant, code, want)
+		}
+	}
+}
+
+// 超出配额的请求在熔断之前被拒绝，熔断器保持关闭且不计入统计
+func TestRpcServerRateLimitBeforeBreaker(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+
+	server, err := zrpc.NewServer(zrpc.RpcServerConf{
+		ServiceConf: service.ServiceConf{
+			Name: "ratelimit.rpc",
+			Log: logx.LogConf{
+				Mode: "console",
+			},
+		},
+		ListenOn: addr,
+	}, func(s *grpc.Server) {
+		proto.RegisterBalancerServer(s, balancer.NewBalancerServer())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter := limit.KeyLimiterFunc(func(key string) (limit.Result, error) {
+		// 请求数量超过桶容量，永远无法放行
+		return limit.Result{State: limit.OverQuota, Limit: 1, RetryAfter: xrate.InfDuration}, nil
+	})
+	server.AddRateLimit(limiter, zrpc.MetadataRateLimitKey("tenant"))
+	go server.Start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, addr, grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	client := proto.NewBalancerClient(conn)
+	limited := metadata.AppendToOutgoingContext(ctx, "tenant", "blocked")
+	for i := 0; i < 100; i++ {
+		var trailer metadata.MD
+		_, err := client.Hello(limited, &proto.Request{}, grpc.Trailer(&trailer))
+		if code := status.Code(err); code != codes.ResourceExhausted {
+			t.Fatalf("request %d: %v; want %v", i, code, codes.ResourceExhausted)
+		}
+		if retry := trailer.Get("retry-after"); len(retry) > 0 {
+			t.Fatalf("request %d: retry-after %v; want omitted", i, retry)
+		}
+	}
+	if _, err := client.Hello(ctx, &proto.Request{}); err != nil {
+		t.Fatalf("request without tenant: %v", err)
+	}
+
+	stats := breaker.GetBreaker("/proto.Balancer/Hello").Stats()
+	if stats.State != breaker.StateClosed || stats.DropRatio != 0 || stats.Total != 1 {
+		t.Errorf("breaker stats: %+v; want closed with only 1 request", stats)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"gozerosource/code/balancer/zrpc/internal"
 	"gozerosource/code/balancer/zrpc/internal/auth"
 	"gozerosource/code/balancer/zrpc/internal/clientinterceptors"
+	"gozerosource/code/balancer/zrpc/internal/codes"
 
 	"google.golang.org/grpc"
 )
@@ -22,6 +23,9 @@ var (
 	WithTransportCredentials = internal.WithTransportCredentials
 	// WithUnaryClientInterceptor is an alias of internal.WithUnaryClientInterceptor.
 	WithUnaryClientInterceptor = internal.WithUnaryClientInterceptor
+	// Retryable checks if the call that returned given error can be retried, the client doesn't
+	// retry by itself, use it in the retry policy of the callers. ResourceExhausted is never retried.
+	Retryable = codes.Retryable
 )
 
 type (
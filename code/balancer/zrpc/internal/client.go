@@ -87,6 +87,7 @@ func (c *client) buildDialOptions(opts ...ClientOption) []grpc.DialOption {
 			clientinterceptors.DurationInterceptor,
 			clientinterceptors.PrometheusInterceptor,
 			clientinterceptors.BreakerInterceptor,
+			clientinterceptors.PriorityInterceptor,
 			clientinterceptors.TimeoutInterceptor(cliOpts.Timeout),
 		),
 		WithStreamClientInterceptors(
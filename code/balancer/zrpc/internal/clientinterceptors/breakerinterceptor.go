@@ -5,8 +5,7 @@ import (
 	"path"
 
 	"gozerosource/code/balancer/zrpc/internal/codes"
-
-	"github.com/zeromicro/go-zero/core/breaker"
+	"gozerosource/code/core/breaker"
 
 	"google.golang.org/grpc"
 )
@@ -17,7 +16,7 @@ func BreakerInterceptor(ctx context.Context, method string, req, reply interface
 	cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption,
 ) error {
 	breakerName := path.Join(cc.Target(), method)
-	return breaker.DoWithAcceptable(breakerName, func() error {
+	return breaker.DoCtxWithClassifier(ctx, breakerName, func(ctx context.Context) error {
 		return invoker(ctx, method, req, reply, cc, opts...)
-	}, codes.Acceptable)
+	}, codes.Classify)
 }
@@ -0,0 +1,23 @@
+package clientinterceptors
+
+import (
+	"context"
+
+	"gozerosource/code/core/load"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// 降载优先级拦截器
+// PriorityInterceptor is an interceptor that passes the load shedding priority in ctx to the server by metadata.
+func PriorityInterceptor(ctx context.Context, method string, req, reply interface{},
+	cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption,
+) error {
+	// 默认优先级无需传递
+	if p := load.PriorityFromContext(ctx); p != load.PriorityDefault {
+		ctx = metadata.AppendToOutgoingContext(ctx, load.PriorityKey, p.String())
+	}
+
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
@@ -0,0 +1,42 @@
+package codes
+
+import (
+	"gozerosource/code/core/breaker"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// 超时按多次失败计算，让熔断器更快地响应下游过载
+const deadlineExceededWeight = 2
+
+// 对错误进行分类并设置熔断权重
+// Classify classifies given error into a weighted breaker outcome.
+func Classify(err error) breaker.Outcome {
+	switch status.Code(err) {
+	case codes.DeadlineExceeded:
+		return breaker.Outcome{
+			Weight: deadlineExceededWeight,
+		}
+	case codes.ResourceExhausted, codes.Internal, codes.Unavailable, codes.DataLoss:
+		return breaker.Outcome{
+			Weight: 1,
+		}
+	default:
+		return breaker.Outcome{
+			Accepted: true,
+			Weight:   1,
+		}
+	}
+}
+
+// 检测失败的请求是否可以重试，下游已明确过载时不应重试，避免加重过载
+// Retryable checks if the call that returned given error can be retried,
+// ResourceExhausted is never retried.
+func Retryable(err error) bool {
+	if status.Code(err) == codes.ResourceExhausted {
+		return false
+	}
+
+	return !Classify(err).Accepted
+}
@@ -0,0 +1,32 @@
+package codes
+
+import (
+	"context"
+	"errors"
+
+	"gozerosource/code/core/load"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// 将请求结果转换为降载的请求结果，与 Classify 一致，客户端错误不代表服务过载，按成功处理
+// Outcome converts given error into a load shedding outcome.
+func Outcome(err error) load.Outcome {
+	if err == nil {
+		return load.OutcomeSuccess
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return load.OutcomeTimeout
+	}
+
+	switch status.Code(err) {
+	case codes.DeadlineExceeded:
+		return load.OutcomeTimeout
+	case codes.ResourceExhausted, codes.Internal, codes.Unavailable, codes.DataLoss:
+		return load.OutcomeError
+	default:
+		return load.OutcomeSuccess
+	}
+}
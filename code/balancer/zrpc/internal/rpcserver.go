@@ -63,8 +63,10 @@ func (s *rpcServer) Start(register RegisterFn) error {
 		serverinterceptors.UnaryCrashInterceptor,
 		serverinterceptors.UnaryStatInterceptor(s.metrics),
 		serverinterceptors.UnaryPrometheusInterceptor,
-		serverinterceptors.UnaryBreakerInterceptor,
 	}
+	// 限流在熔断之前，被限流的请求不计入熔断统计
+	unaryInterceptors = append(unaryInterceptors, s.rateLimitInterceptors...)
+	unaryInterceptors = append(unaryInterceptors, serverinterceptors.UnaryBreakerInterceptor)
 	unaryInterceptors = append(unaryInterceptors, s.unaryInterceptors...)
 	// 基础流拦截器
 	streamInterceptors := []grpc.StreamServerInterceptor{
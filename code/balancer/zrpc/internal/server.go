@@ -19,6 +19,8 @@ type (
 		AddStreamInterceptors(interceptors ...grpc.StreamServerInterceptor)
 		// 添加拦截器
 		AddUnaryInterceptors(interceptors ...grpc.UnaryServerInterceptor)
+		// 添加限流拦截器，在熔断拦截器之前执行
+		AddRateLimitInterceptors(interceptors ...grpc.UnaryServerInterceptor)
 		// 设置服务名称
 		SetName(string)
 		// 启动服务
@@ -32,6 +34,8 @@ type (
 		options            []grpc.ServerOption
 		streamInterceptors []grpc.StreamServerInterceptor
 		unaryInterceptors  []grpc.UnaryServerInterceptor
+		// 限流拦截器，被拒绝的请求不经过熔断及降载
+		rateLimitInterceptors []grpc.UnaryServerInterceptor
 	}
 )
 
@@ -55,6 +59,10 @@ func (s *baseRpcServer) AddUnaryInterceptors(interceptors ...grpc.UnaryServerInt
 	s.unaryInterceptors = append(s.unaryInterceptors, interceptors...)
 }
 
+func (s *baseRpcServer) AddRateLimitInterceptors(interceptors ...grpc.UnaryServerInterceptor) {
+	s.rateLimitInterceptors = append(s.rateLimitInterceptors, interceptors...)
+}
+
 func (s *baseRpcServer) SetName(name string) {
 	s.metrics.SetName(name)
 }
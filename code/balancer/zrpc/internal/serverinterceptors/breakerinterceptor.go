@@ -4,8 +4,8 @@ import (
 	"context"
 
 	"gozerosource/code/balancer/zrpc/internal/codes"
+	"gozerosource/code/core/breaker"
 
-	"github.com/zeromicro/go-zero/core/breaker"
 	"google.golang.org/grpc"
 )
 
@@ -15,9 +15,9 @@ func StreamBreakerInterceptor(srv interface{}, stream grpc.ServerStream, info *g
 	handler grpc.StreamHandler,
 ) (err error) {
 	breakerName := info.FullMethod
-	return breaker.DoWithAcceptable(breakerName, func() error {
+	return breaker.DoCtxWithClassifier(stream.Context(), breakerName, func(context.Context) error {
 		return handler(srv, stream)
-	}, codes.Acceptable)
+	}, codes.Classify)
 }
 
 // 断路拦截器
@@ -26,11 +26,11 @@ func UnaryBreakerInterceptor(ctx context.Context, req interface{}, info *grpc.Un
 	handler grpc.UnaryHandler,
 ) (resp interface{}, err error) {
 	breakerName := info.FullMethod
-	err = breaker.DoWithAcceptable(breakerName, func() error {
+	err = breaker.DoCtxWithClassifier(ctx, breakerName, func(ctx context.Context) error {
 		var err error
 		resp, err = handler(ctx, req)
 		return err
-	}, codes.Acceptable)
+	}, codes.Classify)
 
 	return resp, err
 }
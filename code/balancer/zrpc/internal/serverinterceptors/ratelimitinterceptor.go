@@ -0,0 +1,113 @@
+package serverinterceptors
+
+import (
+	"context"
+	"net"
+	"strconv"
+
+	"gozerosource/code/balancer/zrpc/internal/auth"
+	"gozerosource/code/core/limit"
+
+	"github.com/zeromicro/go-zero/core/logx"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	rateLimitLimitKey     = "x-ratelimit-limit"
+	rateLimitRemainingKey = "x-ratelimit-remaining"
+	rateLimitResetKey     = "x-ratelimit-reset"
+	retryAfterKey         = "retry-after"
+)
+
+// RateLimitKeyFunc defines the method to extract the rate limit key from the request,
+// the request is not limited if the key is empty.
+// 从请求中提取限流的 key，key 为空时不限流
+type RateLimitKeyFunc func(ctx context.Context, info *grpc.UnaryServerInfo) string
+
+// 限流拦截器
+// UnaryRateLimitInterceptor returns a func that limits the unary requests by the key extracted by keyFunc.
+// It returns ResourceExhausted if the request is over quota, the x-ratelimit-limit, x-ratelimit-remaining,
+// x-ratelimit-reset and retry-after (only if over quota and the request can be allowed later)
+// are set in the trailers.
+// The requests are allowed if the limiter fails, like redis is down.
+func UnaryRateLimitInterceptor(limiter limit.KeyLimiter, keyFunc RateLimitKeyFunc) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		key := keyFunc(ctx, info)
+		if len(key) == 0 {
+			return handler(ctx, req)
+		}
+
+		result, err := limiter.TakeResult(key)
+		if err != nil {
+			logx.WithContext(ctx).Errorf("[rpc] rate limiter failed, key: %s, error: %v", key, err)
+			return handler(ctx, req)
+		}
+
+		md := metadata.Pairs(
+			rateLimitLimitKey, strconv.Itoa(result.Limit),
+			rateLimitRemainingKey, strconv.Itoa(result.Remaining),
+		)
+		if reset, ok := limit.FormatSeconds(result.ResetAfter); ok {
+			md.Set(rateLimitResetKey, reset)
+		}
+		if !result.Allowed() {
+			// 永远无法放行时不返回 retry-after
+			if retry, ok := limit.FormatSeconds(result.RetryAfter); ok {
+				md.Set(retryAfterKey, retry)
+			}
+			// 设置失败不影响限流
+			_ = grpc.SetTrailer(ctx, md)
+			logx.WithContext(ctx).Errorf("[rpc] rate limited, key: %s, method: %s", key, info.FullMethod)
+			return nil, status.Error(codes.ResourceExhausted, "rate limit exceeded")
+		}
+
+		_ = grpc.SetTrailer(ctx, md)
+		return handler(ctx, req)
+	}
+}
+
+// AppKey is a RateLimitKeyFunc that uses the app of the credential as the key.
+// 使用权限凭据中的 app 作为限流的 key
+func AppKey(ctx context.Context, _ *grpc.UnaryServerInfo) string {
+	return auth.ParseCredential(ctx).App
+}
+
+// PeerKey is a RateLimitKeyFunc that uses the client ip as the key.
+// 使用客户端 ip 作为限流的 key
+func PeerKey(ctx context.Context, _ *grpc.UnaryServerInfo) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	addr := p.Addr.String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+
+	return addr
+}
+
+// MetadataKey returns a RateLimitKeyFunc that uses the value of the given metadata as the key.
+// 使用指定 metadata 的值作为限流的 key
+func MetadataKey(name string) RateLimitKeyFunc {
+	return func(ctx context.Context, _ *grpc.UnaryServerInfo) string {
+		md, ok := metadata.FromIncomingContext(ctx)
+		if !ok {
+			return ""
+		}
+
+		vals := md.Get(name)
+		if len(vals) == 0 {
+			return ""
+		}
+
+		return vals[0]
+	}
+}
@@ -4,9 +4,12 @@ import (
 	"context"
 	"sync"
 
-	"github.com/zeromicro/go-zero/core/load"
+	"gozerosource/code/balancer/zrpc/internal/codes"
+	"gozerosource/code/core/load"
+
 	"github.com/zeromicro/go-zero/core/stat"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 )
 
 const serviceType = "rpc"
@@ -26,30 +29,47 @@ func UnarySheddingInterceptor(shedder load.Shedder, metrics *stat.Metrics) grpc.
 	) (val interface{}, err error) {
 		sheddingStat.IncrementTotal()
 		var promise load.Promise
-		// 检查是否被降载
-		promise, err = shedder.Allow()
+		// 检查是否被降载，优先级来自客户端的 metadata
+		ctx = priorityContext(ctx)
+		promise, err = shedder.AllowCtx(ctx)
 		// 降载，记录相关日志与指标
 		if err != nil {
 			metrics.AddDrop()
 			sheddingStat.IncrementDrop()
 			return
 		}
-		// 最后回调执行结果
+		// 最后回调执行结果，失败及超时的请求不计入响应时间统计
 		defer func() {
-			// 执行失败
-			if err == context.DeadlineExceeded {
-				promise.Fail()
-				// 执行成功
-			} else {
+			outcome := codes.Outcome(err)
+			if outcome == load.OutcomeSuccess {
 				sheddingStat.IncrementPass()
-				promise.Pass()
 			}
+			promise.Done(outcome)
 		}()
 		// 执行业务方法
 		return handler(ctx, req)
 	}
 }
 
+// 从 metadata 中读取降载优先级
+func priorityContext(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+
+	vals := md.Get(load.PriorityKey)
+	if len(vals) == 0 {
+		return ctx
+	}
+	p, ok := load.ParsePriority(vals[0])
+	if !ok {
+		return ctx
+	}
+
+	return load.NewPriorityContext(ctx, p)
+}
+
 func ensureSheddingStat() {
 	lock.Lock()
 	if sheddingStat == nil {
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"gozerosource/code/balancer/zrpc/internal/codes"
+	"gozerosource/code/core/collection"
 
 	"github.com/zeromicro/go-zero/core/syncx"
 	"github.com/zeromicro/go-zero/core/timex"
@@ -23,13 +24,13 @@ const (
 	// Name is the name of p2c balancer.
 	Name = "p2c_ewma"
 
-	decayTime       = int64(time.Second * 10) // default value from finagle（衰退时间）
-	forcePick       = int64(time.Second)      // 强制节点选取时间间隔
-	initSuccess     = 1000                    // 初始连接健康值
-	throttleSuccess = initSuccess / 2         // 连接非健康临界值
-	penalty         = int64(math.MaxInt32)    // 负载状态最大值
-	pickTimes       = 3                       // 随机选取节点次数
-	logInterval     = time.Minute             // 输出节点状态间隔时间
+	decayTime       = time.Second * 10     // default value from finagle（衰退时间）
+	forcePick       = int64(time.Second)   // 强制节点选取时间间隔
+	initSuccess     = 1000                 // 初始连接健康值
+	throttleSuccess = initSuccess / 2      // 连接非健康临界值
+	penalty         = int64(math.MaxInt32) // 负载状态最大值
+	pickTimes       = 3                    // 随机选取节点次数
+	logInterval     = time.Minute          // 输出节点状态间隔时间
 )
 
 var emptyPickResult balancer.PickResult
@@ -51,10 +52,14 @@ func (b *p2cPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
 
 	var conns []*subConn
 	for conn, connInfo := range readySCs {
+		// 新节点在第一个请求结束前视为健康，第一个请求的结果直接作为健康值
+		success := collection.NewEWMA(decayTime)
+		success.Seed(initSuccess)
 		conns = append(conns, &subConn{
 			addr:    connInfo.Address,
 			conn:    conn,
-			success: initSuccess,
+			lag:     collection.NewEWMA(decayTime),
+			success: success,
 		})
 	}
 
@@ -127,34 +132,21 @@ func (p *p2cPicker) buildDoneFunc(c *subConn) func(info balancer.DoneInfo) {
 		// 正在处理的请求数减 1
 		atomic.AddInt64(&c.inflight, -1)
 		now := timex.Now()
-		// 保存本次请求结束时的时间点，并取出上次请求时的时间点
-		last := atomic.SwapInt64(&c.last, int64(now))
-		td := int64(now) - last
-		if td < 0 {
-			td = 0
-		}
-		// 用牛顿冷却定律中的衰减函数模型计算EWMA算法中的β值
-		// 牛顿冷却算法 https://www.ruanyifeng.com/blog/2012/03/ranking_algorithm_newton_s_law_of_cooling.html
-		w := math.Exp(float64(-td) / float64(decayTime))
 		// 保存本次请求的耗时
 		lag := int64(now) - start
 		if lag < 0 {
 			lag = 0
 		}
-		olag := atomic.LoadUint64(&c.lag)
-		if olag == 0 {
-			w = 0
-		}
-		// 计算 EWMA 值
+		// 计算 EWMA 值，旧值按牛顿冷却定律中的衰减函数随时间衰减
 		// EWMA（指数加权移动平均算法） https://blog.csdn.net/mzpmzk/article/details/80085929
-		atomic.StoreUint64(&c.lag, uint64(float64(olag)*w+float64(lag)*(1-w)))
+		// 牛顿冷却算法 https://www.ruanyifeng.com/blog/2012/03/ranking_algorithm_newton_s_law_of_cooling.html
+		c.lag.Add(float64(lag))
 		success := initSuccess
 		if info.Err != nil && !codes.Acceptable(info.Err) {
 			success = 0
 		}
 		// 健康状态
-		osucc := atomic.LoadUint64(&c.success)
-		atomic.StoreUint64(&c.success, uint64(float64(osucc)*w+float64(success)*(1-w)))
+		c.success.Add(float64(success))
 
 		stamp := p.stamp.Load()
 		if now-stamp >= logInterval {
@@ -206,26 +198,25 @@ func (p *p2cPicker) logStats() {
 }
 
 type subConn struct {
-	lag      uint64 // 用来保存 ewma 值
-	inflight int64  // 用在保存当前节点正在处理的请求总数
-	success  uint64 // 用来标识一段时间内此连接的健康状态
-	requests int64  // 用来保存请求总数
-	last     int64  // 用来保存上一次请求耗时, 用于计算 ewma 值
-	pick     int64  // 保存上一次被选中的时间点
+	lag      *collection.EWMA // 用来保存请求耗时的 ewma 值
+	inflight int64            // 用在保存当前节点正在处理的请求总数
+	success  *collection.EWMA // 用来标识一段时间内此连接的健康状态
+	requests int64            // 用来保存请求总数
+	pick     int64            // 保存上一次被选中的时间点
 	addr     resolver.Address
 	conn     balancer.SubConn
 }
 
 // 节点健康情况
 func (c *subConn) healthy() bool {
-	return atomic.LoadUint64(&c.success) > throttleSuccess
+	return c.success.Value() > throttleSuccess
 }
 
 // 节点负载情况
 func (c *subConn) load() int64 {
 	// plus one to avoid multiply zero
 	// 通过 EWMA 计算节点的负载情况； 加 1 是为了避免为 0 的情况
-	lag := int64(math.Sqrt(float64(atomic.LoadUint64(&c.lag) + 1)))
+	lag := int64(math.Sqrt(c.lag.Value() + 1))
 	load := lag * (atomic.LoadInt64(&c.inflight) + 1)
 	if load == 0 {
 		return penalty
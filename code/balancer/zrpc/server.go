@@ -7,18 +7,37 @@ import (
 	"gozerosource/code/balancer/zrpc/internal"
 	"gozerosource/code/balancer/zrpc/internal/auth"
 	"gozerosource/code/balancer/zrpc/internal/serverinterceptors"
+	"gozerosource/code/core/limit"
+	"gozerosource/code/core/load"
 
-	"github.com/zeromicro/go-zero/core/load"
 	"github.com/zeromicro/go-zero/core/logx"
 	"github.com/zeromicro/go-zero/core/stat"
 	"google.golang.org/grpc"
 )
 
-// A RpcServer is a rpc server.
-type RpcServer struct {
-	server   internal.Server
-	register internal.RegisterFn
-}
+var (
+	// UnaryRateLimitInterceptor is an alias of serverinterceptors.UnaryRateLimitInterceptor,
+	// use RpcServer.AddRateLimit instead of RpcServer.AddUnaryInterceptors to keep the rejected
+	// requests out of the breaker and load shedding.
+	UnaryRateLimitInterceptor = serverinterceptors.UnaryRateLimitInterceptor
+	// AppRateLimitKey uses the app of the credential as the rate limit key.
+	AppRateLimitKey = serverinterceptors.AppKey
+	// PeerRateLimitKey uses the client ip as the rate limit key.
+	PeerRateLimitKey = serverinterceptors.PeerKey
+	// MetadataRateLimitKey uses the value of the given metadata as the rate limit key.
+	MetadataRateLimitKey = serverinterceptors.MetadataKey
+)
+
+type (
+	// RateLimitKeyFunc is an alias of serverinterceptors.RateLimitKeyFunc.
+	RateLimitKeyFunc = serverinterceptors.RateLimitKeyFunc
+
+	// A RpcServer is a rpc server.
+	RpcServer struct {
+		server   internal.Server
+		register internal.RegisterFn
+	}
+)
 
 // MustNewServer returns a RpcSever, exits on any error.
 func MustNewServer(c RpcServerConf, register internal.RegisterFn) *RpcServer {
@@ -89,6 +108,13 @@ func (rs *RpcServer) AddUnaryInterceptors(interceptors ...grpc.UnaryServerInterc
 	rs.server.AddUnaryInterceptors(interceptors...)
 }
 
+// AddRateLimit limits the unary requests by the key extracted by keyFunc, like AppRateLimitKey,
+// the limiter runs before the breaker and load shedding, so the rejected requests are not counted.
+// 添加限流，限流在熔断及降载之前执行，被限流的请求不计入统计
+func (rs *RpcServer) AddRateLimit(limiter limit.KeyLimiter, keyFunc RateLimitKeyFunc) {
+	rs.server.AddRateLimitInterceptors(serverinterceptors.UnaryRateLimitInterceptor(limiter, keyFunc))
+}
+
 // Start starts the RpcServer.
 // Graceful shutdown is enabled by default.
 // Use proc.SetTimeToForceQuit to customize the graceful shutdown period.
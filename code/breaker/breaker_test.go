@@ -1,6 +1,8 @@
 package breaker
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"testing"
 	"time"
@@ -17,14 +19,14 @@ func Test_Breaker(t *testing.T) {
 			break
 		}
 		if i < 10 {
-			allow.Reject()
+			allow.Reject("reject")
 			// time.Sleep(2000 * time.Millisecond)
 			time.Sleep(20 * time.Millisecond)
 		} else {
 			allow.Accept()
 		}
 	}
-	fmt.Println(b.GB.History())
+	fmt.Println(b.Stats())
 }
 
 func Test_Beaker2(t *testing.T) {
@@ -48,7 +50,7 @@ func Test_Beaker2(t *testing.T) {
 			break
 		}
 	}
-	fmt.Println(b.GB.History())
+	fmt.Println(b.Stats())
 }
 
 func Benchmark_BrewkerSerial(b *testing.B) {
@@ -62,10 +64,10 @@ func Benchmark_BrewkerSerial(b *testing.B) {
 		if i%2 == 0 {
 			allow.Accept()
 		} else {
-			allow.Reject()
+			allow.Reject("reject")
 		}
 	}
-	fmt.Println(bk.GB.History())
+	fmt.Println(bk.Stats())
 }
 
 func Benchmark_BrewkerParallel(b *testing.B) {
@@ -83,10 +85,104 @@ func Benchmark_BrewkerParallel(b *testing.B) {
 			if i%100 == 0 {
 				allow.Accept()
 			} else {
-				allow.Reject()
+				allow.Reject("reject")
 			}
 			// time.Sleep(20 * time.Millisecond)
 		}
-		fmt.Println(bk.GB.History())
+		fmt.Println(bk.Stats())
 	})
 }
+
+func Test_GetBreaker(t *testing.T) {
+	b := breaker.GetBreaker("get-breaker")
+	if b.Name() != "get-breaker" {
+		t.Errorf("Name() = %q; want %q", b.Name(), "get-breaker")
+	}
+	if breaker.GetBreaker("get-breaker") != b {
+		t.Error("GetBreaker should return the same breaker for the same name")
+	}
+	if err := breaker.Do("get-breaker", func() error {
+		return nil
+	}); err != nil {
+		t.Errorf("Do: %v", err)
+	}
+	if total := b.Stats().Total; total != 1 {
+		t.Errorf("total = %d; want 1", total)
+	}
+}
+
+func Test_NoBreakerFor(t *testing.T) {
+	var b breaker.Breaker = breaker.NewBreaker(breaker.WithName("nop-breaker"))
+	breaker.NoBreakerFor(b.Name())
+	b = breaker.GetBreaker("nop-breaker")
+	for i := 0; i < 100; i++ {
+		promise, err := b.Allow()
+		if err != nil {
+			t.Fatalf("Allow: %v", err)
+		}
+		promise.Reject("reject")
+	}
+	if stats := b.Stats(); stats.Name != "nop-breaker" || stats.Total != 0 {
+		t.Errorf("Stats() = %+v; want no records", stats)
+	}
+}
+
+func Test_DoWithClassifier(t *testing.T) {
+	errTimeout := errors.New("timeout")
+	errCanceled := errors.New("canceled")
+	classifier := func(err error) breaker.Outcome {
+		switch err {
+		case nil:
+			return breaker.Outcome{Accepted: true, Weight: 1}
+		case errTimeout:
+			return breaker.Outcome{Weight: 2}
+		default:
+			return breaker.Outcome{}
+		}
+	}
+
+	b := breaker.NewBreaker()
+	for _, err := range []error{nil, errTimeout, errCanceled} {
+		err := err
+		if e := b.DoWithClassifier(func() error {
+			return err
+		}, classifier); e != err {
+			t.Errorf("DoWithClassifier: %v; want %v", e, err)
+		}
+	}
+	// 超时按 2 次失败计算，权重为 0 的结果不计入统计
+	if stats := b.Stats(); stats.Accepts != 1 || stats.Total != 3 {
+		t.Errorf("Stats() = %d, %d; want 1, 3", stats.Accepts, stats.Total)
+	}
+}
+
+func Test_DoCtx(t *testing.T) {
+	b := breaker.NewBreaker(breaker.WithName("ctx-breaker"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err := b.DoCtx(ctx, func(ctx context.Context) error {
+		info, ok := breaker.FromContext(ctx)
+		if !ok || info.Name != "ctx-breaker" {
+			t.Errorf("FromContext() = %+v, %t", info, ok)
+		}
+		// 调用方在请求过程中取消，不计入统计
+		cancel()
+		return ctx.Err()
+	})
+	if err != context.Canceled {
+		t.Errorf("DoCtx: %v; want %v", err, context.Canceled)
+	}
+
+	// context 已结束时不执行请求
+	err = b.DoCtx(ctx, func(ctx context.Context) error {
+		t.Error("req should not run with a done context")
+		return nil
+	})
+	if err != context.Canceled {
+		t.Errorf("DoCtx: %v; want %v", err, context.Canceled)
+	}
+
+	if total := b.Stats().Total; total != 0 {
+		t.Errorf("total = %d; want 0", total)
+	}
+}
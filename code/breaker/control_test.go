@@ -0,0 +1,70 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gozerosource/code/core/breaker"
+	"gozerosource/code/core/clock"
+)
+
+func Test_Control(t *testing.T) {
+	const name = "controlled"
+	b := breaker.GetBreaker(name)
+	req := func() error {
+		return nil
+	}
+
+	breaker.ForceOpen(name, time.Minute)
+	if err := b.Do(req); err != breaker.ErrServiceUnavailable {
+		t.Errorf("Do: %v; want %v", err, breaker.ErrServiceUnavailable)
+	}
+	if c, ok := breaker.GetControl(name); !ok || c.Mode != breaker.ControlForceOpen {
+		t.Errorf("GetControl() = %+v, %t", c, ok)
+	}
+	breaker.ResetControl(name)
+	if err := b.Do(req); err != nil {
+		t.Errorf("Do: %v", err)
+	}
+
+	// 强制放行的请求不计入统计
+	errFail := errors.New("fail")
+	breaker.ForceClose(name, time.Minute)
+	for i := 0; i < 100; i++ {
+		if err := b.Do(func() error {
+			return errFail
+		}); err != errFail {
+			t.Fatalf("Do: %v; want %v", err, errFail)
+		}
+	}
+	if total := b.Stats().Total; total != 1 {
+		t.Errorf("total = %d; want 1", total)
+	}
+	breaker.ResetControl(name)
+
+	// 控制项按熔断器的时钟过期后自动失效
+	const fakeName = "controlled-fake-clock"
+	clk := clock.NewFakeClock()
+	fb := breaker.NewBreaker(breaker.WithName(fakeName), breaker.WithClock(clk))
+	if err := breaker.InjectDropRatio(fakeName, 1, 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := fb.Do(req); err != breaker.ErrServiceUnavailable {
+		t.Errorf("Do: %v; want %v", err, breaker.ErrServiceUnavailable)
+	}
+	clk.Advance(10 * time.Millisecond)
+	if c, ok := breaker.GetControl(fakeName); !ok || c.TTL != 10*time.Millisecond {
+		t.Errorf("GetControl() = %+v, %t; want ttl 10ms", c, ok)
+	}
+	clk.Advance(10 * time.Millisecond)
+	if err := fb.Do(req); err != nil {
+		t.Errorf("Do: %v", err)
+	}
+	if _, ok := breaker.GetControl(fakeName); ok {
+		t.Error("control should expire")
+	}
+	if err := breaker.InjectDropRatio(name, 2, time.Minute); err != breaker.ErrInvalidDropRatio {
+		t.Errorf("InjectDropRatio: %v; want %v", err, breaker.ErrInvalidDropRatio)
+	}
+}
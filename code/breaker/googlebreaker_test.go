@@ -2,10 +2,12 @@ package breaker
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
 	"gozerosource/code/core/breaker"
+	"gozerosource/code/core/clock"
 )
 
 // 简单场景直接判断对象是否被熔断，执行请求后必须需手动上报执行结果至熔断器。
@@ -18,14 +20,14 @@ func Test_GoogleBreaker(t *testing.T) {
 			break
 		}
 		if i < 10 {
-			allow.Reject()
+			allow.Reject("reject")
 			// time.Sleep(2000 * time.Millisecond)
 			time.Sleep(20 * time.Millisecond)
 		} else {
 			allow.Accept()
 		}
 	}
-	fmt.Println(gb.History())
+	fmt.Println(gb.Stats())
 }
 
 // 复杂场景下支持自定义快速失败，自定义判定请求是否成功的熔断方法，自动上报执行结果至熔断器。
@@ -54,5 +56,124 @@ func Test_GoogleBreaker2(t *testing.T) {
 			break
 		}
 	}
-	fmt.Println(gb.History())
+	fmt.Println(gb.Stats())
+}
+
+func Test_GoogleBreakerOptions(t *testing.T) {
+	gb := breaker.NewGoogleBreaker(
+		breaker.WithK(1.1),
+		breaker.WithWindow(time.Second),
+		breaker.WithBuckets(10),
+		breaker.WithMinRequests(1000),
+	)
+	// 请求数未达到 minRequests，全部失败也不会熔断
+	for i := 0; i < 100; i++ {
+		allow, err := gb.Allow()
+		if err != nil {
+			t.Fatalf("Allow: %v", err)
+		}
+		allow.Reject("reject")
+	}
+	if stats := gb.Stats(); stats.Accepts != 0 || stats.Total != 100 {
+		t.Errorf("Stats() = %d, %d; want 0, 100", stats.Accepts, stats.Total)
+	}
+}
+
+// k 小于 1 时被忽略，否则没有失败也会熔断
+func Test_GoogleBreakerInvalidK(t *testing.T) {
+	for _, k := range []float64{-1, 0, 0.5} {
+		gb := breaker.NewGoogleBreaker(breaker.WithK(k), breaker.WithMinRequests(0))
+		for i := 0; i < 100; i++ {
+			allow, err := gb.Allow()
+			if err != nil {
+				t.Fatalf("k %v, request %d: %v", k, i, err)
+			}
+			allow.Accept()
+		}
+		if stats := gb.Stats(); stats.DropRatio != 0 {
+			t.Errorf("k %v: DropRatio = %v; want 0", k, stats.DropRatio)
+		}
+	}
+}
+
+func Test_GoogleBreakerConf(t *testing.T) {
+	// 非法的窗口数量被忽略，不会 panic
+	gb := breaker.NewGoogleBreaker(breaker.WithBuckets(0), breaker.WithWindow(0))
+	if _, err := gb.Allow(); err != nil {
+		t.Fatalf("Allow: %v", err)
+	}
+
+	// 显式设置 MinRequests 为 0，3 个失败请求即开始熔断，默认值 5 时不会熔断
+	var minRequests int64
+	gb = breaker.NewGoogleBreaker(breaker.WithConf(breaker.BreakerConf{
+		MinRequests: &minRequests,
+	}))
+	for i := 0; i < 3; i++ {
+		if allow, err := gb.Allow(); err == nil {
+			allow.Reject("reject")
+		}
+	}
+	if stats := gb.Stats(); stats.DropRatio <= 0 {
+		t.Errorf("DropRatio = %v; want > 0", stats.DropRatio)
+	}
+}
+
+// 默认熔断器（googleBreaker）的状态变更通知及统计快照
+func Test_GoogleBreakerObserver(t *testing.T) {
+	clk := clock.NewFakeClock()
+	var events []breaker.Event
+	var global []breaker.Event
+	breaker.Subscribe(func(event breaker.Event) {
+		if event.Name == "google-observed" {
+			global = append(global, event)
+		}
+	})
+	b := breaker.NewBreaker(
+		breaker.WithName("google-observed"),
+		breaker.WithClock(clk),
+		breaker.WithWindow(time.Second),
+		breaker.WithMinRequests(2),
+		breaker.WithObserver(func(event breaker.Event) {
+			events = append(events, event)
+		}),
+	)
+	for i := 0; i < 3; i++ {
+		promise, err := b.Allow()
+		if err != nil {
+			t.Fatalf("Allow: %v", err)
+		}
+		promise.Reject(fmt.Sprintf("reason %d", i))
+	}
+
+	// 下一次请求时熔断概率大于 0，进入限流状态
+	_, _ = b.Allow()
+	if len(events) != 1 || events[0].From != breaker.StateClosed || events[0].To != breaker.StateThrottling ||
+		events[0].DropRatio <= 0 || events[0].Name != "google-observed" {
+		t.Fatalf("events = %+v; want closed -> throttling", events)
+	}
+	stats := b.Stats()
+	if stats.Name != "google-observed" || stats.State != breaker.StateThrottling || stats.DropRatio <= 0 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+	if stats.Accepts != 0 || stats.Total < 3 {
+		t.Errorf("Stats() = %d, %d; want 0, >= 3", stats.Accepts, stats.Total)
+	}
+	if len(stats.Reasons) != 3 || !strings.HasSuffix(stats.Reasons[0], "reason 2") {
+		t.Errorf("Reasons = %v; want latest first", stats.Reasons)
+	}
+
+	// 窗口滑过后恢复正常
+	clk.Advance(2 * time.Second)
+	if _, err := b.Allow(); err != nil {
+		t.Fatalf("Allow: %v", err)
+	}
+	if len(events) != 2 || events[1].From != breaker.StateThrottling || events[1].To != breaker.StateClosed {
+		t.Fatalf("events = %+v; want throttling -> closed", events)
+	}
+	if len(global) != len(events) {
+		t.Errorf("global events = %+v; want %+v", global, events)
+	}
+	if stats := b.Stats(); stats.State != breaker.StateClosed || stats.DropRatio != 0 {
+		t.Errorf("Stats() = %+v", stats)
+	}
 }
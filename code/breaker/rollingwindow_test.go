@@ -2,9 +2,12 @@ package breaker
 
 import (
 	"fmt"
+	"math"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"gozerosource/code/core/clock"
 	"gozerosource/code/core/collection"
 )
 
@@ -37,3 +40,265 @@ func Test_RollingWindow(t *testing.T) {
 	fmt.Println("accepts", accepts)
 	fmt.Println("total", total)
 }
+
+func Test_ShardedRollingWindow(t *testing.T) {
+	bucketDuration := time.Duration(int64(windowSec) / int64(buckets))
+	for _, ignoreCurrent := range []bool{false, true} {
+		var opts []collection.RollingWindowOption
+		if ignoreCurrent {
+			opts = append(opts, collection.IgnoreCurrentBucket())
+		}
+		st := collection.NewRollingWindow(buckets, bucketDuration, opts...)
+		sst := collection.NewShardedRollingWindow(buckets, bucketDuration, opts...)
+		for i := 0; i < 50; i++ {
+			time.Sleep(10 * time.Millisecond)
+			st.Add(float64(i))
+			sst.Add(float64(i))
+		}
+		sum, count := reduce(st.Reduce)
+		ssum, scount := reduce(sst.Reduce)
+		fmt.Println("ignoreCurrent", ignoreCurrent, "sum", sum, ssum, "count", count, scount)
+		// 两次汇总之间可能跨过桶边界，只做宽松比较
+		if count == 0 || scount == 0 || count-scount > 5 || scount-count > 5 {
+			t.Errorf("sharded count %d, want about %d", scount, count)
+		}
+	}
+}
+
+func reduce(fn func(func(b *collection.Bucket))) (float64, int64) {
+	var sum float64
+	var count int64
+	fn(func(b *collection.Bucket) {
+		sum += b.Sum
+		count += b.Count
+	})
+	return sum, count
+}
+
+// 并发写入时对比 RollingWindow 与 ShardedRollingWindow，可用 -cpu 1,4,8 观察多核下的差异
+func Benchmark_RollingWindowParallelAdd(b *testing.B) {
+	interval := time.Duration(int64(windowSec) / int64(buckets))
+	windows := []struct {
+		name string
+		add  func(float64)
+	}{
+		{"rolling", collection.NewRollingWindow(buckets, interval).Add},
+		{"sharded", collection.NewShardedRollingWindow(buckets, interval).Add},
+	}
+	for _, w := range windows {
+		for _, parallelism := range []int{1, 8, 64} {
+			add := w.add
+			b.Run(fmt.Sprintf("%s-%d", w.name, parallelism), func(b *testing.B) {
+				b.SetParallelism(parallelism)
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						add(1)
+					}
+				})
+			})
+		}
+	}
+}
+
+func Benchmark_ShardedRollingWindowReduce(b *testing.B) {
+	st := collection.NewShardedRollingWindow(buckets, time.Duration(int64(windowSec)/int64(buckets)))
+	for i := 0; i < 1000; i++ {
+		st.Add(1)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		st.Reduce(func(b *collection.Bucket) {})
+	}
+}
+
+func Test_HistogramRollingWindow(t *testing.T) {
+	bucketDuration := time.Duration(int64(windowSec) / int64(buckets))
+	clk := clock.NewFakeClock()
+	hw := collection.NewHistogramRollingWindow(buckets, bucketDuration, collection.WithClock(clk))
+	for i := 1; i <= 1000; i++ {
+		hw.Add(float64(i))
+	}
+	for _, p := range []float64{50, 90, 99} {
+		v := hw.Percentile(p)
+		fmt.Printf("p%.0f: %.2f\n", p, v)
+		// 分位数相对误差不超过 1/16
+		want := p * 10
+		if math.Abs(v-want)/want > 1.0/16 {
+			t.Errorf("p%.0f = %.2f, want about %.2f", p, v, want)
+		}
+	}
+
+	// 过期后清空
+	clk.Advance(windowSec)
+	if v := hw.Percentile(99); v != 0 {
+		t.Errorf("p99 after window = %.2f, want 0", v)
+	}
+}
+
+// 小于 1 的值同样保持 1/16 的相对误差，0 及负数按 0 计算
+func Test_HistogramSubUnit(t *testing.T) {
+	for _, scale := range []float64{1e-6, 1e-3, 0.5} {
+		h := collection.NewHistogram()
+		for i := 1; i <= 1000; i++ {
+			h.Add(float64(i) * scale / 1000)
+		}
+		for _, q := range []float64{0.5, 0.9, 0.99} {
+			v := h.Quantile(q)
+			want := q * scale
+			if math.Abs(v-want)/want > 1.0/16 {
+				t.Errorf("scale %g: q%.2f = %g, want about %g", scale, q, v, want)
+			}
+		}
+	}
+
+	h := collection.NewHistogram()
+	h.Add(0)
+	h.Add(-1)
+	h.Add(0.25)
+	if v := h.Quantile(0.5); v != 0 {
+		t.Errorf("q0.5 = %g, want 0", v)
+	}
+	if v := h.Quantile(1); math.Abs(v-0.25)/0.25 > 1.0/16 {
+		t.Errorf("q1 = %g, want about 0.25", v)
+	}
+}
+
+func Test_RollingWindowSlide(t *testing.T) {
+	const interval = 100 * time.Millisecond
+	clk := clock.NewFakeClock()
+	st := collection.NewRollingWindow(4, interval, collection.WithClock(clk))
+	sst := collection.NewShardedRollingWindow(4, interval, collection.WithClock(clk))
+	// 每个桶写入 1、2、3、4
+	for i := 1; i <= 4; i++ {
+		st.Add(float64(i))
+		sst.Add(float64(i))
+		clk.Advance(interval)
+	}
+	// 已经滑过一个桶，第一个桶过期
+	for _, fn := range []func(func(b *collection.Bucket)){st.Reduce, sst.Reduce} {
+		if sum, count := reduce(fn); sum != 9 || count != 3 {
+			t.Errorf("sum: %v, count: %d; want 9, 3", sum, count)
+		}
+	}
+
+	// 整个窗口过期
+	clk.Advance(4 * interval)
+	for _, fn := range []func(func(b *collection.Bucket)){st.Reduce, sst.Reduce} {
+		if sum, count := reduce(fn); sum != 0 || count != 0 {
+			t.Errorf("sum: %v, count: %d; want 0, 0", sum, count)
+		}
+	}
+}
+
+func Test_EWMA(t *testing.T) {
+	const decay = time.Second
+	clk := clock.NewFakeClock()
+	e := collection.NewEWMA(decay, collection.WithClock(clk))
+	e.Add(100)
+	if v := e.Value(); v != 100 {
+		t.Errorf("Value: %v; want 100", v)
+	}
+
+	clk.Advance(decay)
+	e.Add(0)
+	if v := e.Value(); math.Abs(v-100/math.E) > 1e-9 {
+		t.Errorf("Value: %v; want %v", v, 100/math.E)
+	}
+}
+
+// Seed 的值只在添加数据之前生效
+func Test_EWMASeed(t *testing.T) {
+	clk := clock.NewFakeClock()
+	e := collection.NewEWMA(time.Second, collection.WithClock(clk))
+	e.Seed(1000)
+	if v := e.Value(); v != 1000 {
+		t.Errorf("Value: %v; want 1000", v)
+	}
+	e.Add(0)
+	if v := e.Value(); v != 0 {
+		t.Errorf("Value: %v; want 0", v)
+	}
+}
+
+// 与 p2c 原来手写的衰减算法结果一致
+func Test_EWMAParity(t *testing.T) {
+	const decay = 10 * time.Second
+	clk := clock.NewFakeClock()
+	e := collection.NewEWMA(decay, collection.WithClock(clk))
+	var ref p2cEWMA
+	for i := 0; i < 1000; i++ {
+		clk.Advance(time.Duration(i%7) * 10 * time.Millisecond)
+		// 原算法把 0 视为没有数据，所以避免添加 0
+		v := float64(i%13*1000 + 1)
+		e.Add(v)
+		ref.add(int64(clk.Now()), decay, v)
+		if got, want := e.Value(), ref.value(); math.Abs(got-want) > 1e-6*math.Max(1, want) {
+			t.Fatalf("add %d: %v; want %v", i, got, want)
+		}
+	}
+}
+
+// 时钟为 0 时也只有第一个数据直接作为当前值
+func Test_EWMAZeroTime(t *testing.T) {
+	e := collection.NewEWMA(time.Second, collection.WithClock(zeroClock{}))
+	e.Add(100)
+	e.Add(0)
+	if v := e.Value(); v != 100 {
+		t.Errorf("Value: %v; want 100", v)
+	}
+}
+
+func Benchmark_EWMAParallelAdd(b *testing.B) {
+	const decay = 10 * time.Second
+	b.Run("ewma", func(b *testing.B) {
+		e := collection.NewEWMA(decay)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				e.Add(1000)
+			}
+		})
+	})
+	b.Run("p2c", func(b *testing.B) {
+		var ref p2cEWMA
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				ref.add(int64(clock.Real.Now()), decay, 1000)
+			}
+		})
+	})
+}
+
+// p2c 原来手写的衰减算法，用于对比，保留了小数部分
+type p2cEWMA struct {
+	last int64
+	val  uint64
+}
+
+func (p *p2cEWMA) add(now int64, decay time.Duration, v float64) {
+	last := atomic.SwapInt64(&p.last, now)
+	td := now - last
+	if td < 0 {
+		td = 0
+	}
+	w := math.Exp(float64(-td) / float64(decay))
+	old := atomic.LoadUint64(&p.val)
+	if old == 0 {
+		w = 0
+	}
+	atomic.StoreUint64(&p.val, math.Float64bits(math.Float64frombits(old)*w+v*(1-w)))
+}
+
+func (p *p2cEWMA) value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&p.val))
+}
+
+// 停在 0 的时钟
+type zeroClock struct{}
+
+func (zeroClock) Now() time.Duration {
+	return 0
+}
+
+func (zeroClock) Since(d time.Duration) time.Duration {
+	return -d
+}
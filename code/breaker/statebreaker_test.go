@@ -0,0 +1,159 @@
+package breaker
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"gozerosource/code/core/breaker"
+	"gozerosource/code/core/clock"
+)
+
+func Test_StateBreaker(t *testing.T) {
+	clk := clock.NewFakeClock()
+	b := breaker.NewBreaker(
+		breaker.WithClock(clk),
+		breaker.WithStateMachine(),
+		breaker.WithConsecutiveFailures(3),
+		breaker.WithSleepWindow(50*time.Millisecond),
+		breaker.WithHalfOpenProbes(2),
+	)
+	errFail := errors.New("fail")
+	for i := 0; i < 3; i++ {
+		if err := b.Do(func() error {
+			return errFail
+		}); err != errFail {
+			t.Fatalf("Do: %v; want %v", err, errFail)
+		}
+	}
+	// 连续失败 3 次后熔断
+	if err := b.Do(func() error {
+		return nil
+	}); err != breaker.ErrServiceUnavailable {
+		t.Fatalf("Do: %v; want %v", err, breaker.ErrServiceUnavailable)
+	}
+
+	// 熔断时间到达后进入半开状态，只允许 2 个探测请求
+	clk.Advance(60 * time.Millisecond)
+	p1, err := b.Allow()
+	if err != nil {
+		t.Fatalf("Allow: %v", err)
+	}
+	p2, err := b.Allow()
+	if err != nil {
+		t.Fatalf("Allow: %v", err)
+	}
+	if _, err := b.Allow(); err != breaker.ErrServiceUnavailable {
+		t.Fatalf("Allow: %v; want %v", err, breaker.ErrServiceUnavailable)
+	}
+
+	// 探测请求全部成功后恢复
+	p1.Accept()
+	p2.Accept()
+	if err := b.Do(func() error {
+		return nil
+	}); err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+}
+
+func Test_StateBreakerHalfOpenFailure(t *testing.T) {
+	clk := clock.NewFakeClock()
+	b := breaker.NewBreaker(
+		breaker.WithClock(clk),
+		breaker.WithStateMachine(),
+		breaker.WithConsecutiveFailures(1),
+		breaker.WithSleepWindow(50*time.Millisecond),
+	)
+	errFail := errors.New("fail")
+	_ = b.Do(func() error {
+		return errFail
+	})
+	clk.Advance(60 * time.Millisecond)
+	// 探测失败，重新熔断
+	_ = b.Do(func() error {
+		return errFail
+	})
+	if _, err := b.Allow(); err != breaker.ErrServiceUnavailable {
+		t.Fatalf("Allow: %v; want %v", err, breaker.ErrServiceUnavailable)
+	}
+}
+
+func Test_StateBreakerStalePromise(t *testing.T) {
+	clk := clock.NewFakeClock()
+	b := breaker.NewBreaker(
+		breaker.WithClock(clk),
+		breaker.WithStateMachine(),
+		breaker.WithConsecutiveFailures(1),
+		breaker.WithSleepWindow(50*time.Millisecond),
+	)
+	// 熔断前放行的请求，在半开状态下才结束
+	stale, err := b.Allow()
+	if err != nil {
+		t.Fatalf("Allow: %v", err)
+	}
+	_ = b.Do(func() error {
+		return errors.New("fail")
+	})
+	clk.Advance(60 * time.Millisecond)
+	probe, err := b.Allow()
+	if err != nil {
+		t.Fatalf("Allow: %v", err)
+	}
+
+	// 过期请求的结果被忽略，熔断器仍处于半开状态
+	stale.Accept()
+	if _, err := b.Allow(); err != breaker.ErrServiceUnavailable {
+		t.Fatalf("Allow after stale accept: %v; want %v", err, breaker.ErrServiceUnavailable)
+	}
+	stale.Reject("stale")
+	probe.Accept()
+	if err := b.Do(func() error {
+		return nil
+	}); err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+}
+
+func Test_StateBreakerObserver(t *testing.T) {
+	var events []breaker.Event
+	clk := clock.NewFakeClock()
+	b := breaker.NewBreaker(
+		breaker.WithName("observed"),
+		breaker.WithClock(clk),
+		breaker.WithStateMachine(),
+		breaker.WithConsecutiveFailures(2),
+		breaker.WithObserver(func(event breaker.Event) {
+			events = append(events, event)
+		}),
+	)
+	for i := 0; i < 2; i++ {
+		promise, err := b.Allow()
+		if err != nil {
+			t.Fatalf("Allow: %v", err)
+		}
+		// 事件和失败原因的时间使用熔断器的时钟
+		clk.Advance(time.Hour)
+		promise.Reject(fmt.Sprintf("reason %d", i))
+	}
+
+	if len(events) != 1 || events[0].From != breaker.StateClosed || events[0].To != breaker.StateOpen {
+		t.Fatalf("events = %v; want closed -> open", events)
+	}
+	if now := clock.Time(clk); !events[0].Time.Equal(now) {
+		t.Errorf("Time = %v; want %v", events[0].Time, now)
+	}
+	stats := b.Stats()
+	if stats.Name != "observed" || stats.State != breaker.StateOpen || stats.DropRatio != 1 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+	if len(stats.Reasons) != 2 || !strings.HasSuffix(stats.Reasons[0], "reason 1") {
+		t.Errorf("Reasons = %v; want latest first", stats.Reasons)
+	}
+	earlier := clock.Time(clk).Add(-time.Hour).Format("15:04:05")
+	if len(stats.Reasons) == 2 && !strings.HasPrefix(stats.Reasons[1], earlier) {
+		t.Errorf("Reasons = %v; want %s for the earlier one", stats.Reasons, earlier)
+	}
+}
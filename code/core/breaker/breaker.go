@@ -1,5 +1,19 @@
 package breaker
 
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gozerosource/code/core/clock"
+	"gozerosource/code/core/syncx"
+
+	"github.com/zeromicro/go-zero/core/stringx"
+)
+
+// default to be enabled
+var enabled = syncx.ForAtomicBool(true)
+
 type (
 	// 自定义判定执行结果
 	Acceptable func(err error) bool
@@ -12,6 +26,8 @@ type (
 		// 请求失败
 		Reject(reason string)
 	}
+	// A Breaker represents a circuit breaker.
+	// 熔断器接口定义
 	Breaker interface {
 		// 熔断器名称
 		Name() string
@@ -37,11 +53,71 @@ type (
 		// fallback - 支持自定义快速失败
 		// acceptable - 支持自定义判定执行结果
 		DoWithFallbackAcceptable(req func() error, fallback func(err error) error, acceptable Acceptable) error
+
+		// 熔断方法
+		// classifier - 支持按错误类型设置不同的权重
+		DoWithClassifier(req func() error, classifier Classifier) error
+
+		// 熔断方法
+		// fallback - 支持自定义快速失败
+		// classifier - 支持按错误类型设置不同的权重
+		DoWithFallbackClassifier(req func() error, fallback func(err error) error, classifier Classifier) error
+
+		// 熔断方法，支持 context
+		// ctx 已结束时直接返回 ctx.Err()，不执行请求
+		// 调用方主动取消的请求不计入统计
+		DoCtx(ctx context.Context, req func(ctx context.Context) error) error
+
+		// 熔断方法，支持 context
+		// acceptable - 支持自定义判定执行结果
+		DoCtxWithAcceptable(ctx context.Context, req func(ctx context.Context) error, acceptable Acceptable) error
+
+		// 熔断方法，支持 context
+		// classifier - 支持按错误类型设置不同的权重
+		DoCtxWithClassifier(ctx context.Context, req func(ctx context.Context) error, classifier Classifier) error
+
+		// 统计快照
+		Stats() Stats
 	}
 
-	internalPromise interface {
-		Accept()
-		Reject()
+	// BreakerOption defines the method to customize a Breaker.
+	// option参数模式
+	BreakerOption func(opts *breakerOptions)
+
+	// 可选配置参数
+	breakerOptions struct {
+		// 熔断器名称
+		name string
+		// 倍值（越小越敏感）
+		k float64
+		// 滑动时间窗口大小
+		window time.Duration
+		// 滑动时间窗口数量
+		buckets int
+		// 窗口内最少请求数，低于此值时不熔断
+		minRequests int64
+		// 是否使用 closed/open/half-open 状态机熔断器
+		stateMachine bool
+		// 连续失败多少次后熔断，0 表示不启用
+		maxFailures int64
+		// 窗口内失败比例达到多少后熔断，0 表示不启用
+		failureRatio float64
+		// 熔断后多久进入半开状态
+		sleepWindow time.Duration
+		// 半开状态下允许通过的探测请求数
+		halfOpenProbes int
+		// 状态变更观察者
+		observers []Observer
+		// 时钟，测试时可替换为手动推进的时钟
+		clock clock.Clock
+	}
+
+	// 熔断策略，googleBreaker 和 stateBreaker 均实现了此接口
+	throttle interface {
+		Allow() (Promise, error)
+		doReq(req func() error, fallback func(err error) error, classifier Classifier) error
+		currentState() State
+		Stats() Stats
 	}
 )
 
@@ -50,35 +126,234 @@ func defaultAcceptable(err error) bool {
 }
 
 type breaker struct {
-	GB *googleBreaker
+	name     string
+	throttle throttle
+}
+
+// Disable lets callers disable circuit breaking, NewBreaker returns no-op breakers afterwards.
+// 关闭熔断，之后创建的熔断器均为空实现
+func Disable() {
+	enabled.Set(false)
 }
 
-func NewBreaker() *breaker {
-	return &breaker{
-		GB: NewGoogleBreaker(),
+// NewBreaker returns a Breaker.
+// opts can be used to customize the Breaker.
+// 未指定名称时随机生成一个
+func NewBreaker(opts ...BreakerOption) Breaker {
+	options := newBreakerOptions(opts...)
+	if len(options.name) == 0 {
+		options.name = stringx.Rand()
+	}
+	// 关闭时返回默认的空实现，保证调用方代码统一
+	if !enabled.True() {
+		return newNopBreaker(options.name)
+	}
+
+	// 运行时控制的有效期按熔断器的时钟计算
+	setControlClock(options.name, options.clock)
+	b := &breaker{
+		name: options.name,
+	}
+	// 默认使用 google sre 算法，可通过 WithStateMachine 切换为状态机熔断器
+	if options.stateMachine {
+		b.throttle = newStateBreaker(options)
+	} else {
+		b.throttle = newGoogleBreaker(options)
 	}
+
+	return b
 }
 
 func (b *breaker) Name() string {
-	return ""
+	return b.name
 }
 
-func (b *breaker) Allow() (internalPromise, error) {
-	return b.GB.Allow()
+func (b *breaker) Allow() (Promise, error) {
+	bypass, err := controlled(b.name)
+	if err != nil {
+		return nil, err
+	}
+	// 强制放行时不上报结果
+	if bypass {
+		return nopPromise{}, nil
+	}
+
+	return b.throttle.Allow()
 }
 
 func (b *breaker) Do(req func() error) error {
-	return b.GB.DoReq(req, nil, defaultAcceptable)
+	return b.doReq(req, nil, acceptableClassifier(defaultAcceptable))
 }
 
 func (b *breaker) DoWithAcceptable(req func() error, acceptable Acceptable) error {
-	return b.GB.DoReq(req, nil, acceptable)
+	return b.doReq(req, nil, acceptableClassifier(acceptable))
 }
 
 func (b *breaker) DoWithFallback(req func() error, fallback func(err error) error) error {
-	return b.GB.DoReq(req, fallback, defaultAcceptable)
+	return b.doReq(req, fallback, acceptableClassifier(defaultAcceptable))
 }
 
 func (b *breaker) DoWithFallbackAcceptable(req func() error, fallback func(err error) error, acceptable Acceptable) error {
-	return b.GB.DoReq(req, fallback, acceptable)
+	return b.doReq(req, fallback, acceptableClassifier(acceptable))
+}
+
+func (b *breaker) DoWithClassifier(req func() error, classifier Classifier) error {
+	return b.doReq(req, nil, classifier)
+}
+
+func (b *breaker) DoWithFallbackClassifier(req func() error, fallback func(err error) error,
+	classifier Classifier,
+) error {
+	return b.doReq(req, fallback, classifier)
+}
+
+func (b *breaker) DoCtx(ctx context.Context, req func(ctx context.Context) error) error {
+	return b.doCtx(ctx, req, acceptableClassifier(defaultAcceptable))
+}
+
+func (b *breaker) DoCtxWithAcceptable(ctx context.Context, req func(ctx context.Context) error,
+	acceptable Acceptable,
+) error {
+	return b.doCtx(ctx, req, acceptableClassifier(acceptable))
+}
+
+func (b *breaker) DoCtxWithClassifier(ctx context.Context, req func(ctx context.Context) error,
+	classifier Classifier,
+) error {
+	return b.doCtx(ctx, req, classifier)
+}
+
+func (b *breaker) doCtx(ctx context.Context, req func(ctx context.Context) error, classifier Classifier) error {
+	// 调用方已取消或超时，不再执行请求
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ctx = newContext(ctx, Info{
+		Name:  b.name,
+		State: b.throttle.currentState(),
+	})
+	return b.doReq(func() error {
+		return req(ctx)
+	}, nil, func(err error) Outcome {
+		// 调用方主动取消的请求不代表下游异常，不计入统计
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return Outcome{}
+		}
+
+		return classifier(err)
+	})
+}
+
+// 运行时控制优先于熔断器的判定
+func (b *breaker) doReq(req func() error, fallback func(err error) error, classifier Classifier) error {
+	bypass, err := controlled(b.name)
+	if err != nil {
+		if fallback != nil {
+			return fallback(err)
+		}
+
+		return err
+	}
+	// 强制放行时直接执行请求，不计入统计
+	if bypass {
+		return req()
+	}
+
+	return b.throttle.doReq(req, fallback, classifier)
+}
+
+// Stats returns a snapshot of the breaker.
+// 统计快照
+func (b *breaker) Stats() Stats {
+	return b.throttle.Stats()
+}
+
+// 加载默认配置并应用 opts
+func newBreakerOptions(opts ...BreakerOption) breakerOptions {
+	options := breakerOptions{
+		k:           defaultK,
+		window:      defaultWindow,
+		buckets:     defaultBuckets,
+		minRequests: defaultProtection,
+		clock:       clock.Real,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return options
+}
+
+// WithName returns a function to set the name of a Breaker.
+// 设置熔断器名称
+func WithName(name string) BreakerOption {
+	return func(opts *breakerOptions) {
+		opts.name = name
+	}
+}
+
+// WithClock returns a function to set the Clock of a Breaker, mostly used in tests.
+// 设置时钟，用于测试
+func WithClock(c clock.Clock) BreakerOption {
+	return func(opts *breakerOptions) {
+		opts.clock = c
+	}
+}
+
+// WithK customizes the Breaker with given k, the smaller k is, the more aggressive the Breaker is.
+// k less than 1 is ignored, because the Breaker would throttle the requests even without failures.
+// 设置倍值，越小越敏感，小于 1 时即使没有失败也会熔断，因此忽略
+func WithK(k float64) BreakerOption {
+	return func(opts *breakerOptions) {
+		if k >= 1 {
+			opts.k = k
+		}
+	}
+}
+
+// WithWindow customizes the Breaker with given window size, non-positive values are ignored.
+// 设置滑动时间窗口大小，小于等于 0 时忽略
+func WithWindow(window time.Duration) BreakerOption {
+	return func(opts *breakerOptions) {
+		if window > 0 {
+			opts.window = window
+		}
+	}
+}
+
+// WithBuckets customizes the Breaker with given number of buckets, non-positive values are ignored.
+// 设置滑动时间窗口数量，小于等于 0 时忽略
+func WithBuckets(buckets int) BreakerOption {
+	return func(opts *breakerOptions) {
+		if buckets > 0 {
+			opts.buckets = buckets
+		}
+	}
+}
+
+// WithMinRequests customizes the Breaker with the minimum requests in the window
+// before it starts to reject requests.
+// 设置窗口内最少请求数，低 QPS 的服务可以调小
+func WithMinRequests(n int64) BreakerOption {
+	return func(opts *breakerOptions) {
+		opts.minRequests = n
+	}
+}
+
+// WithConf customizes the Breaker with given config, zero values are ignored,
+// except MinRequests which is honored when it's set, even to 0.
+// 通过配置文件设置熔断器
+func WithConf(c BreakerConf) BreakerOption {
+	return func(opts *breakerOptions) {
+		if len(c.Name) > 0 {
+			opts.name = c.Name
+		}
+		WithK(c.K)(opts)
+		WithWindow(c.Window)(opts)
+		WithBuckets(c.Buckets)(opts)
+		if c.MinRequests != nil {
+			opts.minRequests = *c.MinRequests
+		}
+	}
 }
@@ -0,0 +1,133 @@
+package breaker
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// 进程内熔断器注册表，按名称复用熔断器
+var (
+	lock     sync.RWMutex
+	breakers = make(map[string]Breaker)
+)
+
+// Do calls Breaker.Do on the Breaker with given name.
+func Do(name string, req func() error) error {
+	return do(name, func(b Breaker) error {
+		return b.Do(req)
+	})
+}
+
+// DoWithAcceptable calls Breaker.DoWithAcceptable on the Breaker with given name.
+func DoWithAcceptable(name string, req func() error, acceptable Acceptable) error {
+	return do(name, func(b Breaker) error {
+		return b.DoWithAcceptable(req, acceptable)
+	})
+}
+
+// DoWithFallback calls Breaker.DoWithFallback on the Breaker with given name.
+func DoWithFallback(name string, req func() error, fallback func(err error) error) error {
+	return do(name, func(b Breaker) error {
+		return b.DoWithFallback(req, fallback)
+	})
+}
+
+// DoWithFallbackAcceptable calls Breaker.DoWithFallbackAcceptable on the Breaker with given name.
+func DoWithFallbackAcceptable(name string, req func() error, fallback func(err error) error,
+	acceptable Acceptable,
+) error {
+	return do(name, func(b Breaker) error {
+		return b.DoWithFallbackAcceptable(req, fallback, acceptable)
+	})
+}
+
+// DoWithClassifier calls Breaker.DoWithClassifier on the Breaker with given name.
+func DoWithClassifier(name string, req func() error, classifier Classifier) error {
+	return do(name, func(b Breaker) error {
+		return b.DoWithClassifier(req, classifier)
+	})
+}
+
+// DoWithFallbackClassifier calls Breaker.DoWithFallbackClassifier on the Breaker with given name.
+func DoWithFallbackClassifier(name string, req func() error, fallback func(err error) error,
+	classifier Classifier,
+) error {
+	return do(name, func(b Breaker) error {
+		return b.DoWithFallbackClassifier(req, fallback, classifier)
+	})
+}
+
+// DoCtx calls Breaker.DoCtx on the Breaker with given name.
+func DoCtx(ctx context.Context, name string, req func(ctx context.Context) error) error {
+	return do(name, func(b Breaker) error {
+		return b.DoCtx(ctx, req)
+	})
+}
+
+// DoCtxWithAcceptable calls Breaker.DoCtxWithAcceptable on the Breaker with given name.
+func DoCtxWithAcceptable(ctx context.Context, name string, req func(ctx context.Context) error,
+	acceptable Acceptable,
+) error {
+	return do(name, func(b Breaker) error {
+		return b.DoCtxWithAcceptable(ctx, req, acceptable)
+	})
+}
+
+// DoCtxWithClassifier calls Breaker.DoCtxWithClassifier on the Breaker with given name.
+func DoCtxWithClassifier(ctx context.Context, name string, req func(ctx context.Context) error,
+	classifier Classifier,
+) error {
+	return do(name, func(b Breaker) error {
+		return b.DoCtxWithClassifier(ctx, req, classifier)
+	})
+}
+
+// GetBreaker returns the Breaker with the given name.
+// 获取指定名称的熔断器，不存在时创建（双重检查，避免重复创建）
+func GetBreaker(name string) Breaker {
+	lock.RLock()
+	b, ok := breakers[name]
+	lock.RUnlock()
+	if ok {
+		return b
+	}
+
+	lock.Lock()
+	b, ok = breakers[name]
+	if !ok {
+		b = NewBreaker(WithName(name))
+		breakers[name] = b
+	}
+	lock.Unlock()
+
+	return b
+}
+
+// ListBreakers returns all the Breakers in the registry, sorted by name.
+// 获取注册表中的所有熔断器
+func ListBreakers() []Breaker {
+	lock.RLock()
+	list := make([]Breaker, 0, len(breakers))
+	for _, b := range breakers {
+		list = append(list, b)
+	}
+	lock.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name() < list[j].Name()
+	})
+	return list
+}
+
+// NoBreakerFor disables the circuit breaker for the given name, the runtime controls have no effect on it.
+// 关闭指定名称的熔断，运行时控制对其无效
+func NoBreakerFor(name string) {
+	lock.Lock()
+	breakers[name] = newNopBreaker(name)
+	lock.Unlock()
+}
+
+func do(name string, execute func(b Breaker) error) error {
+	return execute(GetBreaker(name))
+}
@@ -0,0 +1,26 @@
+package breaker
+
+type (
+	// An Outcome tells the Breaker how to record the result of a call.
+	// 请求结果的判定
+	Outcome struct {
+		// 请求是否成功
+		Accepted bool
+		// 计入统计的权重，比如超时可以按 2 次失败计算，0 表示不计入统计
+		Weight int64
+	}
+
+	// Classifier classifies the result of a call into an Outcome.
+	// 自定义判定执行结果及其权重
+	Classifier func(err error) Outcome
+)
+
+// 将 Acceptable 转换为权重为 1 的 Classifier
+func acceptableClassifier(acceptable Acceptable) Classifier {
+	return func(err error) Outcome {
+		return Outcome{
+			Accepted: acceptable(err),
+			Weight:   1,
+		}
+	}
+}
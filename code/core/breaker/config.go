@@ -0,0 +1,13 @@
+package breaker
+
+import "time"
+
+// A BreakerConf is a breaker config.
+// 熔断器配置
+type BreakerConf struct {
+	Name        string        `json:",optional"`    // 熔断器名称
+	K           float64       `json:",default=1.5"` // 倍值（越小越敏感），小于 1 时忽略
+	Window      time.Duration `json:",default=10s"` // 滑动时间窗口大小
+	Buckets     int           `json:",default=40"`  // 滑动时间窗口数量
+	MinRequests *int64        `json:",optional"`    // 窗口内最少请求数，低于此值时不熔断，未设置时为 5，可以设置为 0
+}
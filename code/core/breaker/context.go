@@ -0,0 +1,24 @@
+package breaker
+
+import "context"
+
+// 熔断器信息在 context 中的 key
+type breakerKey struct{}
+
+// Info is the breaker info attached to the context by DoCtx, mainly for logging.
+// 请求所经过的熔断器信息
+type Info struct {
+	Name  string // 熔断器名称
+	State State  // 执行请求时熔断器的状态
+}
+
+// FromContext returns the breaker info attached to ctx by DoCtx.
+// 获取 context 中的熔断器信息
+func FromContext(ctx context.Context) (Info, bool) {
+	info, ok := ctx.Value(breakerKey{}).(Info)
+	return info, ok
+}
+
+func newContext(ctx context.Context, info Info) context.Context {
+	return context.WithValue(ctx, breakerKey{}, info)
+}
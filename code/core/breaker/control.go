@@ -0,0 +1,235 @@
+package breaker
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"gozerosource/code/core/clock"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// ErrInvalidDropRatio is returned when the injected drop ratio is not in (0, 1].
+var ErrInvalidDropRatio = errors.New("drop ratio must be in (0, 1]")
+
+// ControlMode is the mode to override the decisions of a Breaker at runtime.
+// The controls have no effect on the no-op breakers, like the ones created after Disable or by NoBreakerFor.
+// 运行时控制模式，用于故障演练，对关闭熔断后的空实现熔断器无效
+type ControlMode int
+
+const (
+	// ControlForceOpen rejects all requests.
+	// 强制熔断，拒绝所有请求
+	ControlForceOpen ControlMode = iota + 1
+	// ControlForceClose allows all requests, the results are not recorded.
+	// 强制放行，所有请求直接执行且不计入统计
+	ControlForceClose
+	// ControlDropRatio drops requests on the given ratio before the Breaker decides.
+	// 按给定概率丢弃请求，未丢弃的请求仍由熔断器判定
+	ControlDropRatio
+)
+
+func (m ControlMode) String() string {
+	switch m {
+	case ControlForceOpen:
+		return "force-open"
+	case ControlForceClose:
+		return "force-close"
+	case ControlDropRatio:
+		return "drop-ratio"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (m ControlMode) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// A Control is a runtime override of a Breaker.
+// 运行时控制
+type Control struct {
+	Name      string        // 熔断器名称
+	Mode      ControlMode   // 控制模式
+	DropRatio float64       // 丢弃概率，仅 ControlDropRatio 模式有效
+	TTL       time.Duration // 剩余有效时间
+}
+
+// 控制项，过期后自动失效
+type override struct {
+	mode      ControlMode
+	dropRatio float64
+	expire    time.Duration
+}
+
+var (
+	controlLock sync.RWMutex
+	controls    = make(map[string]override)
+	// 使用自定义时钟的熔断器，控制项的有效期按熔断器的时钟计算，其余使用 clock.Real
+	controlClocks = make(map[string]clock.Clock)
+	// 用于按概率丢弃请求
+	controlProba = NewProba()
+)
+
+// ForceOpen forces the Breaker with given name to reject all requests for ttl.
+// 强制熔断指定名称的熔断器，ttl 后自动失效
+func ForceOpen(name string, ttl time.Duration) {
+	setControl(name, override{
+		mode: ControlForceOpen,
+	}, ttl)
+}
+
+// ForceClose forces the Breaker with given name to allow all requests for ttl.
+// 强制放行指定名称的熔断器，ttl 后自动失效
+func ForceClose(name string, ttl time.Duration) {
+	setControl(name, override{
+		mode: ControlForceClose,
+	}, ttl)
+}
+
+// InjectDropRatio drops requests of the Breaker with given name on ratio for ttl.
+// 为指定名称的熔断器注入丢弃概率，ttl 后自动失效
+func InjectDropRatio(name string, ratio float64, ttl time.Duration) error {
+	if ratio <= 0 || ratio > 1 {
+		return ErrInvalidDropRatio
+	}
+
+	setControl(name, override{
+		mode:      ControlDropRatio,
+		dropRatio: ratio,
+	}, ttl)
+	return nil
+}
+
+// ResetControl removes the runtime override of the Breaker with given name.
+// 移除指定名称熔断器的运行时控制
+func ResetControl(name string) {
+	controlLock.Lock()
+	delete(controls, name)
+	controlLock.Unlock()
+	logx.Infof("breaker control of %s reset", name)
+}
+
+// GetControl returns the runtime override of the Breaker with given name.
+// 获取指定名称熔断器的运行时控制
+func GetControl(name string) (Control, bool) {
+	o, ok := getControl(name)
+	if !ok {
+		return Control{}, false
+	}
+
+	return Control{
+		Name:      name,
+		Mode:      o.mode,
+		DropRatio: o.dropRatio,
+		TTL:       o.expire - controlClock(name).Now(),
+	}, true
+}
+
+// Controls returns all the active runtime overrides, sorted by name.
+// 获取所有生效中的运行时控制
+func Controls() []Control {
+	controlLock.RLock()
+	names := make([]string, 0, len(controls))
+	for name := range controls {
+		names = append(names, name)
+	}
+	controlLock.RUnlock()
+	sort.Strings(names)
+
+	var result []Control
+	for _, name := range names {
+		if c, ok := GetControl(name); ok {
+			result = append(result, c)
+		}
+	}
+
+	return result
+}
+
+func setControl(name string, o override, ttl time.Duration) {
+	controlLock.Lock()
+	o.expire = controlClockLocked(name).Now() + ttl
+	controls[name] = o
+	controlLock.Unlock()
+	logx.Infof("breaker %s is set to %s for %s", name, o.mode, ttl)
+}
+
+// 获取生效中的控制项，过期的控制项会被清理
+func getControl(name string) (override, bool) {
+	controlLock.RLock()
+	if len(controls) == 0 {
+		controlLock.RUnlock()
+		return override{}, false
+	}
+	o, ok := controls[name]
+	now := controlClockLocked(name).Now()
+	controlLock.RUnlock()
+	if !ok {
+		return override{}, false
+	}
+	if now < o.expire {
+		return o, true
+	}
+
+	controlLock.Lock()
+	// 防止清理掉期间重新设置的控制项
+	if cur, ok := controls[name]; ok && cur.expire == o.expire {
+		delete(controls, name)
+	}
+	controlLock.Unlock()
+
+	return override{}, false
+}
+
+// 记录熔断器的时钟，只记录自定义的时钟，避免随机名称的熔断器占用内存
+func setControlClock(name string, c clock.Clock) {
+	if c == clock.Real {
+		return
+	}
+
+	controlLock.Lock()
+	controlClocks[name] = c
+	controlLock.Unlock()
+}
+
+// 控制项有效期使用的时钟
+func controlClock(name string) clock.Clock {
+	controlLock.RLock()
+	defer controlLock.RUnlock()
+	return controlClockLocked(name)
+}
+
+// 调用方需持有 controlLock
+func controlClockLocked(name string) clock.Clock {
+	if c, ok := controlClocks[name]; ok {
+		return c
+	}
+
+	return clock.Real
+}
+
+// 判断运行时控制是否覆盖熔断器的判定
+// bypass 为 true 时跳过熔断器直接执行请求
+func controlled(name string) (bypass bool, err error) {
+	o, ok := getControl(name)
+	if !ok {
+		return false, nil
+	}
+
+	switch o.mode {
+	case ControlForceOpen:
+		return false, ErrServiceUnavailable
+	case ControlForceClose:
+		return true, nil
+	case ControlDropRatio:
+		if controlProba.TrueOnProba(o.dropRatio) {
+			return false, ErrServiceUnavailable
+		}
+	}
+
+	return false, nil
+}
@@ -2,20 +2,23 @@ package breaker
 
 import (
 	"errors"
+	"fmt"
 	"math"
 	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"gozerosource/code/core/clock"
 	"gozerosource/code/core/collection"
 )
 
 const (
 	// 250ms for bucket duration
-	windowSec  = time.Second * 10 // 窗口时间
-	buckets    = 40               // bucket 数量
-	k          = 1.5              // 倍值（越小越敏感）
-	protection = 5
+	defaultWindow     = time.Second * 10 // 窗口时间
+	defaultBuckets    = 40               // bucket 数量
+	defaultK          = 1.5              // 倍值（越小越敏感）
+	defaultProtection = 5                // 窗口内请求数低于此值时不熔断
 )
 
 // A Proba is used to test if true on given probability.
@@ -47,29 +50,51 @@ var ErrServiceUnavailable = errors.New("circuit breaker is open")
 // googleBreaker is a netflixBreaker pattern from google.
 // see Client-Side Throttling section in https://landing.google.com/sre/sre-book/chapters/handling-overload/
 type googleBreaker struct {
-	k     float64
-	stat  *collection.RollingWindow
-	proba *Proba
+	name       string
+	k          float64
+	protection int64
+	stat       *collection.RollingWindow
+	proba      *Proba
+	// 当前状态，StateClosed 或 StateThrottling
+	state int32
+	// 最近的失败原因
+	reasons *reasonWindow
+	// 状态变更观察者
+	observers []Observer
+	// 时钟，用于状态变更和失败原因的时间
+	clock clock.Clock
 }
 
-func NewGoogleBreaker() *googleBreaker {
-	bucketDuration := time.Duration(int64(windowSec) / int64(buckets))
-	st := collection.NewRollingWindow(buckets, bucketDuration)
+// NewGoogleBreaker returns a googleBreaker.
+// opts can be used to customize k, window, buckets and the protection floor.
+func NewGoogleBreaker(opts ...BreakerOption) *googleBreaker {
+	return newGoogleBreaker(newBreakerOptions(opts...))
+}
+
+func newGoogleBreaker(options breakerOptions) *googleBreaker {
 	return &googleBreaker{
-		stat:  st,
-		k:     k,
-		proba: NewProba(),
+		name:       options.name,
+		stat:       newRollingWindow(options),
+		k:          options.k,
+		protection: options.minRequests,
+		proba:      NewProba(),
+		reasons:    newReasonWindow(options.clock),
+		observers:  options.observers,
+		clock:      options.clock,
 	}
 }
 
+// 初始化请求统计的滑动窗口
+func newRollingWindow(options breakerOptions) *collection.RollingWindow {
+	bucketDuration := time.Duration(int64(options.window) / int64(options.buckets))
+	return collection.NewRollingWindow(options.buckets, bucketDuration,
+		collection.WithClock(options.clock))
+}
+
 // 判断是否触发熔断
 func (b *googleBreaker) accept() error {
-	// 获取最近一段时间的统计数据
-	accepts, total := b.History()
-	// 计算动态熔断概率
-	weightedAccepts := b.k * float64(accepts)
-	// Google Sre过载保护算法 https://landing.google.com/sre/sre-book/chapters/handling-overload/#eq2101
-	dropRatio := math.Max(0, (float64(total-protection)-weightedAccepts)/float64(total+1))
+	dropRatio := b.dropRatio()
+	b.updateState(dropRatio)
 	if dropRatio <= 0 {
 		return nil
 	}
@@ -82,11 +107,35 @@ func (b *googleBreaker) accept() error {
 	return nil
 }
 
+// 计算动态熔断概率
+func (b *googleBreaker) dropRatio() float64 {
+	// 获取最近一段时间的统计数据
+	accepts, total := b.history()
+	weightedAccepts := b.k * float64(accepts)
+	// Google Sre过载保护算法 https://landing.google.com/sre/sre-book/chapters/handling-overload/#eq2101
+	return math.Max(0, (float64(total-b.protection)-weightedAccepts)/float64(total+1))
+}
+
+// 熔断概率由 0 变为非 0 时进入限流状态，反之恢复正常，状态变更时通知观察者
+func (b *googleBreaker) updateState(dropRatio float64) {
+	to := StateClosed
+	if dropRatio > 0 {
+		to = StateThrottling
+	}
+	from := State(atomic.LoadInt32(&b.state))
+	if from == to {
+		return
+	}
+	if atomic.CompareAndSwapInt32(&b.state, int32(from), int32(to)) {
+		notify(b.clock, b.name, b.observers, from, to, dropRatio)
+	}
+}
+
 // 熔断方法，执行请求时必须手动上报执行结果
 // 适用于简单无需自定义快速失败，无需自定义判定请求结果的场景
 // 相当于手动挡。。。
 // 返回一个promise异步回调对象，可由开发者自行决定是否上报结果到熔断器
-func (b *googleBreaker) Allow() (internalPromise, error) {
+func (b *googleBreaker) Allow() (Promise, error) {
 	if err := b.accept(); err != nil {
 		return nil, err
 	}
@@ -102,6 +151,18 @@ func (b *googleBreaker) Allow() (internalPromise, error) {
 // fallback 自定义快速失败函数，可对熔断产生的err进行包装后返回
 // acceptable 对本次未熔断时执行请求的结果进行自定义的判定，比如可以针对http.code,rpc.code,body.code
 func (b *googleBreaker) DoReq(req func() error, fallback func(err error) error, acceptable Acceptable) error {
+	return b.doReq(req, fallback, acceptableClassifier(acceptable))
+}
+
+// DoReqWithClassifier is like DoReq, but records weighted outcomes classified by classifier.
+// 与 DoReq 相同，classifier 可以为不同的错误设置不同的权重
+func (b *googleBreaker) DoReqWithClassifier(req func() error, fallback func(err error) error,
+	classifier Classifier,
+) error {
+	return b.doReq(req, fallback, classifier)
+}
+
+func (b *googleBreaker) doReq(req func() error, fallback func(err error) error, classifier Classifier) error {
 	// 判定是否熔断
 	if err := b.accept(); err != nil {
 		// 熔断中，如果有自定义的fallback则执行
@@ -114,36 +175,64 @@ func (b *googleBreaker) DoReq(req func() error, fallback func(err error) error,
 	// 如果执行req()过程发生了panic，依然判定本次执行失败上报至熔断器
 	defer func() {
 		if e := recover(); e != nil {
-			b.markFailure()
+			b.markFailure(1, fmt.Sprint("panic: ", e))
 			panic(e)
 		}
 	}()
 	// 执行请求
 	err := req()
-	// 判定请求成功
-	if acceptable(err) {
-		b.markSuccess()
+	// 判定请求成功，按权重上报
+	outcome := classifier(err)
+	if outcome.Accepted {
+		b.markSuccess(outcome.Weight)
 	} else {
-		b.markFailure()
+		b.markFailure(outcome.Weight, reasonOf(err))
 	}
 
 	return err
 }
 
-// 上报成功
-func (b *googleBreaker) markSuccess() {
-	b.stat.Add(1)
+// 上报成功，weight 为计入统计的次数
+func (b *googleBreaker) markSuccess(weight int64) {
+	if weight <= 0 {
+		return
+	}
+
+	b.stat.AddN(float64(weight), weight)
 }
 
-// 上报失败
-func (b *googleBreaker) markFailure() {
-	b.stat.Add(0)
+// 上报失败，并记录失败原因，weight 为计入统计的次数
+func (b *googleBreaker) markFailure(weight int64, reason string) {
+	if weight <= 0 {
+		return
+	}
+
+	b.reasons.add(reason)
+	b.stat.AddN(0, weight)
+}
+
+func (b *googleBreaker) currentState() State {
+	return State(atomic.LoadInt32(&b.state))
+}
+
+// Stats returns a snapshot of the googleBreaker.
+// 统计快照
+func (b *googleBreaker) Stats() Stats {
+	accepts, total := b.history()
+	return Stats{
+		Name:      b.name,
+		State:     b.currentState(),
+		Accepts:   accepts,
+		Total:     total,
+		DropRatio: b.dropRatio(),
+		Reasons:   b.reasons.list(),
+	}
 }
 
 // 统计数据
 // accepts 成功次数
 // total 总次数
-func (b *googleBreaker) History() (accepts, total int64) {
+func (b *googleBreaker) history() (accepts, total int64) {
 	b.stat.Reduce(func(b *collection.Bucket) {
 		accepts += int64(b.Sum)
 		total += b.Count
@@ -158,10 +247,10 @@ type googlePromise struct {
 
 // 正常请求计数
 func (p googlePromise) Accept() {
-	p.b.markSuccess()
+	p.b.markSuccess(1)
 }
 
 // 异常请求计数
-func (p googlePromise) Reject() {
-	p.b.markFailure()
+func (p googlePromise) Reject(reason string) {
+	p.b.markFailure(1, reason)
 }
@@ -0,0 +1,88 @@
+package breaker
+
+import "context"
+
+// 空实现熔断器，熔断关闭时使用
+type nopBreaker struct {
+	name string
+}
+
+func newNopBreaker(name string) Breaker {
+	return nopBreaker{
+		name: name,
+	}
+}
+
+func (b nopBreaker) Name() string {
+	return b.name
+}
+
+func (b nopBreaker) Allow() (Promise, error) {
+	return nopPromise{}, nil
+}
+
+func (b nopBreaker) Do(req func() error) error {
+	return req()
+}
+
+func (b nopBreaker) DoWithAcceptable(req func() error, acceptable Acceptable) error {
+	return req()
+}
+
+func (b nopBreaker) DoWithFallback(req func() error, fallback func(err error) error) error {
+	return req()
+}
+
+func (b nopBreaker) DoWithFallbackAcceptable(req func() error, fallback func(err error) error,
+	acceptable Acceptable,
+) error {
+	return req()
+}
+
+func (b nopBreaker) DoWithClassifier(req func() error, classifier Classifier) error {
+	return req()
+}
+
+func (b nopBreaker) DoWithFallbackClassifier(req func() error, fallback func(err error) error,
+	classifier Classifier,
+) error {
+	return req()
+}
+
+func (b nopBreaker) DoCtx(ctx context.Context, req func(ctx context.Context) error) error {
+	return doCtx(ctx, req)
+}
+
+func (b nopBreaker) DoCtxWithAcceptable(ctx context.Context, req func(ctx context.Context) error,
+	acceptable Acceptable,
+) error {
+	return doCtx(ctx, req)
+}
+
+func (b nopBreaker) DoCtxWithClassifier(ctx context.Context, req func(ctx context.Context) error,
+	classifier Classifier,
+) error {
+	return doCtx(ctx, req)
+}
+
+func (b nopBreaker) Stats() Stats {
+	return Stats{
+		Name: b.name,
+	}
+}
+
+type nopPromise struct{}
+
+func (p nopPromise) Accept() {
+}
+
+func (p nopPromise) Reject(reason string) {
+}
+
+func doCtx(ctx context.Context, req func(ctx context.Context) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return req(ctx)
+}
@@ -0,0 +1,177 @@
+package breaker
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"gozerosource/code/core/clock"
+
+	"github.com/zeromicro/go-zero/core/mathx"
+)
+
+const (
+	numHistoryReasons = 5          // 保留最近的失败原因数量
+	timeFormat        = "15:04:05" // 失败原因的时间格式
+)
+
+// State is the state of a Breaker.
+// 熔断器状态
+type State int32
+
+const (
+	// StateClosed means requests are allowed.
+	// 关闭：请求正常通过
+	StateClosed State = iota
+	// StateOpen means requests are rejected.
+	// 打开：请求直接失败
+	StateOpen
+	// StateHalfOpen means a limited number of probe requests are allowed.
+	// 半开：允许少量探测请求通过
+	StateHalfOpen
+	// StateThrottling means requests are dropped on a probability, used by googleBreaker.
+	// 限流：按熔断概率丢弃请求（googleBreaker）
+	StateThrottling
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	case StateThrottling:
+		return "throttling"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+type (
+	// An Event describes a state transition of a Breaker.
+	// 熔断器状态变更事件
+	Event struct {
+		Name      string    // 熔断器名称
+		From      State     // 变更前状态
+		To        State     // 变更后状态
+		DropRatio float64   // 当前熔断概率
+		Time      time.Time // 变更时间
+	}
+
+	// Observer is called on every state transition of a Breaker.
+	// Observers are called synchronously, so they should return quickly.
+	// 状态变更回调，同步调用，不应阻塞
+	Observer func(event Event)
+
+	// Stats is a snapshot of a Breaker.
+	// 熔断器统计快照
+	Stats struct {
+		Name      string   // 熔断器名称
+		State     State    // 当前状态
+		Accepts   int64    // 窗口内成功次数
+		Total     int64    // 窗口内总次数
+		DropRatio float64  // 当前熔断概率
+		Reasons   []string // 最近的失败原因，最新的在前
+	}
+)
+
+var (
+	observerLock sync.RWMutex
+	// 全局观察者，对所有熔断器生效
+	observers []Observer
+)
+
+// Subscribe adds an Observer that is notified on state transitions of all Breakers.
+// 订阅所有熔断器的状态变更，比如接入告警
+func Subscribe(observer Observer) {
+	observerLock.Lock()
+	observers = append(observers, observer)
+	observerLock.Unlock()
+}
+
+// WithObserver returns a function to add an Observer to a Breaker.
+// 订阅指定熔断器的状态变更
+func WithObserver(observer Observer) BreakerOption {
+	return func(opts *breakerOptions) {
+		opts.observers = append(opts.observers, observer)
+	}
+}
+
+// 通知状态变更，变更时间使用熔断器的时钟
+func notify(c clock.Clock, name string, local []Observer, from, to State, dropRatio float64) {
+	if from == to {
+		return
+	}
+
+	event := Event{
+		Name:      name,
+		From:      from,
+		To:        to,
+		DropRatio: dropRatio,
+		Time:      clock.Time(c),
+	}
+	for _, observer := range local {
+		observer(event)
+	}
+
+	observerLock.RLock()
+	global := observers
+	observerLock.RUnlock()
+	for _, observer := range global {
+		observer(event)
+	}
+}
+
+// 环形数组，保存最近的失败原因
+type reasonWindow struct {
+	reasons [numHistoryReasons]string
+	index   int
+	count   int
+	lock    sync.Mutex
+	// 记录失败时间的时钟
+	clock clock.Clock
+}
+
+func newReasonWindow(c clock.Clock) *reasonWindow {
+	return &reasonWindow{
+		clock: c,
+	}
+}
+
+func (rw *reasonWindow) add(reason string) {
+	rw.lock.Lock()
+	rw.reasons[rw.index] = fmt.Sprintf("%s %s", clock.Time(rw.clock).Format(timeFormat), reason)
+	rw.index = (rw.index + 1) % numHistoryReasons
+	rw.count = mathx.MinInt(rw.count+1, numHistoryReasons)
+	rw.lock.Unlock()
+}
+
+// 最近的失败原因，最新的在前
+func (rw *reasonWindow) list() []string {
+	rw.lock.Lock()
+	defer rw.lock.Unlock()
+
+	reasons := make([]string, 0, rw.count)
+	// reverse order
+	for i := rw.index - 1; i >= rw.index-rw.count; i-- {
+		reasons = append(reasons, rw.reasons[(i+numHistoryReasons)%numHistoryReasons])
+	}
+
+	return reasons
+}
+
+// 根据执行结果生成失败原因
+func reasonOf(err error) string {
+	if err == nil {
+		return "unacceptable result"
+	}
+
+	return err.Error()
+}
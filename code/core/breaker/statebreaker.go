@@ -0,0 +1,377 @@
+package breaker
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"gozerosource/code/core/collection"
+)
+
+const (
+	defaultMaxFailures    = 5               // 默认连续失败次数
+	defaultSleepWindow    = time.Second * 5 // 默认熔断持续时间
+	defaultHalfOpenProbes = 1               // 默认半开探测请求数
+)
+
+// stateBreaker is a classic closed/open/half-open circuit breaker.
+// 经典状态机熔断器
+// closed - 连续失败次数或窗口内失败比例达到阈值后 -> open
+// open - 经过 sleepWindow 后 -> half-open
+// half-open - 探测请求全部成功 -> closed，任一失败 -> open
+type stateBreaker struct {
+	name string
+	lock sync.Mutex
+	// 当前状态
+	state State
+	// 状态代数，每次状态变更加一，用于忽略上一个状态发出的请求的结果
+	generation uint64
+	// 进入 open 状态的时间
+	openTime time.Duration
+	// 连续失败次数
+	failures int64
+	// 半开状态下正在处理的探测请求数
+	probes int
+	// 半开状态下成功的探测请求数
+	successes int
+	// 连续失败阈值
+	maxFailures int64
+	// 失败比例阈值
+	failureRatio float64
+	// 熔断持续时间
+	sleepWindow time.Duration
+	// 半开探测请求数
+	halfOpenProbes int
+	// 失败比例生效的最少请求数
+	minRequests int64
+	// 请求数统计，与 googleBreaker 相同的滑动窗口
+	stat *collection.RollingWindow
+	// 用于重建滑动窗口
+	options breakerOptions
+	// 最近的失败原因
+	reasons *reasonWindow
+}
+
+func newStateBreaker(options breakerOptions) *stateBreaker {
+	// 未指定任何熔断条件时，默认使用连续失败次数
+	if options.maxFailures <= 0 && options.failureRatio <= 0 {
+		options.maxFailures = defaultMaxFailures
+	}
+	if options.sleepWindow <= 0 {
+		options.sleepWindow = defaultSleepWindow
+	}
+	if options.halfOpenProbes <= 0 {
+		options.halfOpenProbes = defaultHalfOpenProbes
+	}
+
+	return &stateBreaker{
+		name:           options.name,
+		maxFailures:    options.maxFailures,
+		failureRatio:   options.failureRatio,
+		sleepWindow:    options.sleepWindow,
+		halfOpenProbes: options.halfOpenProbes,
+		minRequests:    options.minRequests,
+		stat:           newRollingWindow(options),
+		options:        options,
+		reasons:        newReasonWindow(options.clock),
+	}
+}
+
+// 判断是否触发熔断，返回放行时的状态代数
+func (b *stateBreaker) accept() (uint64, error) {
+	b.lock.Lock()
+	from := b.state
+	err := b.acceptLocked()
+	to := b.state
+	generation := b.generation
+	b.lock.Unlock()
+
+	b.notify(from, to)
+	return generation, err
+}
+
+// 调用方需持有锁
+func (b *stateBreaker) acceptLocked() error {
+	switch b.state {
+	case StateOpen:
+		// 熔断时间未到，直接失败
+		if b.options.clock.Since(b.openTime) < b.sleepWindow {
+			return ErrServiceUnavailable
+		}
+		// 熔断时间已到，进入半开状态
+		b.setState(StateHalfOpen)
+		b.probes = 0
+		b.successes = 0
+		fallthrough
+	case StateHalfOpen:
+		// 探测请求已满，其余请求直接失败
+		if b.probes >= b.halfOpenProbes {
+			return ErrServiceUnavailable
+		}
+		b.probes++
+	}
+
+	return nil
+}
+
+// Allow 返回一个 promise 异步回调对象，由开发者自行上报结果到熔断器
+func (b *stateBreaker) Allow() (Promise, error) {
+	generation, err := b.accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return statePromise{
+		b:          b,
+		generation: generation,
+	}, nil
+}
+
+// 自动上报执行结果，参数含义与 googleBreaker.DoReqWithClassifier 相同
+func (b *stateBreaker) doReq(req func() error, fallback func(err error) error, classifier Classifier) error {
+	generation, err := b.accept()
+	if err != nil {
+		if fallback != nil {
+			return fallback(err)
+		}
+
+		return err
+	}
+	// 如果执行req()过程发生了panic，依然判定本次执行失败上报至熔断器
+	defer func() {
+		if e := recover(); e != nil {
+			b.markFailure(generation, 1, fmt.Sprint("panic: ", e))
+			panic(e)
+		}
+	}()
+
+	err = req()
+	outcome := classifier(err)
+	if outcome.Accepted {
+		b.markSuccess(generation, outcome.Weight)
+	} else {
+		b.markFailure(generation, outcome.Weight, reasonOf(err))
+	}
+
+	return err
+}
+
+func (b *stateBreaker) currentState() State {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.state
+}
+
+// Stats returns a snapshot of the stateBreaker.
+// 统计快照
+func (b *stateBreaker) Stats() Stats {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	stats := Stats{
+		Name:    b.name,
+		State:   b.state,
+		Reasons: b.reasons.list(),
+	}
+	b.stat.Reduce(func(b *collection.Bucket) {
+		stats.Accepts += int64(b.Sum)
+		stats.Total += b.Count
+	})
+	if b.state == StateOpen {
+		stats.DropRatio = 1
+	}
+
+	return stats
+}
+
+// 上报成功，weight 为计入统计的次数，generation 为放行时的状态代数
+// 上一个状态放行的请求的结果被忽略，避免过期的请求关闭半开状态的熔断器
+func (b *stateBreaker) markSuccess(generation uint64, weight int64) {
+	b.lock.Lock()
+	if generation != b.generation {
+		b.lock.Unlock()
+		return
+	}
+	from := b.state
+	b.markSuccessLocked(weight)
+	to := b.state
+	b.lock.Unlock()
+
+	b.notify(from, to)
+}
+
+// 调用方需持有锁
+func (b *stateBreaker) markSuccessLocked(weight int64) {
+	// 不计入统计的请求只释放探测名额
+	if weight <= 0 {
+		b.releaseProbe()
+		return
+	}
+
+	b.stat.AddN(float64(weight), weight)
+	switch b.state {
+	case StateClosed:
+		b.failures = 0
+	case StateHalfOpen:
+		b.releaseProbe()
+		b.successes++
+		// 所有探测请求均成功，恢复正常
+		if b.successes >= b.halfOpenProbes {
+			b.close()
+		}
+	}
+}
+
+// 上报失败，并记录失败原因，weight 为计入统计的次数，generation 为放行时的状态代数
+func (b *stateBreaker) markFailure(generation uint64, weight int64, reason string) {
+	b.lock.Lock()
+	if generation != b.generation {
+		b.lock.Unlock()
+		return
+	}
+	if weight > 0 {
+		b.reasons.add(reason)
+	}
+	from := b.state
+	b.markFailureLocked(weight)
+	to := b.state
+	b.lock.Unlock()
+
+	b.notify(from, to)
+}
+
+// 调用方需持有锁
+func (b *stateBreaker) markFailureLocked(weight int64) {
+	if weight <= 0 {
+		b.releaseProbe()
+		return
+	}
+
+	b.stat.AddN(0, weight)
+	switch b.state {
+	case StateClosed:
+		b.failures += weight
+		if b.shouldTrip() {
+			b.open()
+		}
+	case StateHalfOpen:
+		// 探测失败，重新熔断
+		b.releaseProbe()
+		b.open()
+	}
+}
+
+// 是否达到熔断条件，调用方需持有锁
+func (b *stateBreaker) shouldTrip() bool {
+	if b.maxFailures > 0 && b.failures >= b.maxFailures {
+		return true
+	}
+	if b.failureRatio <= 0 {
+		return false
+	}
+
+	var accepts, total int64
+	b.stat.Reduce(func(b *collection.Bucket) {
+		accepts += int64(b.Sum)
+		total += b.Count
+	})
+	// 请求数过少时不计算失败比例
+	if total < b.minRequests {
+		return false
+	}
+
+	return float64(total-accepts)/float64(total) >= b.failureRatio
+}
+
+func (b *stateBreaker) open() {
+	b.setState(StateOpen)
+	b.openTime = b.options.clock.Now()
+}
+
+func (b *stateBreaker) close() {
+	b.setState(StateClosed)
+	b.failures = 0
+	// 丢弃熔断前的统计数据，避免恢复后立即再次熔断
+	b.stat = newRollingWindow(b.options)
+}
+
+// 变更状态并增加状态代数，调用方需持有锁
+func (b *stateBreaker) setState(state State) {
+	b.state = state
+	b.generation++
+}
+
+// 状态变更时通知观察者
+func (b *stateBreaker) notify(from, to State) {
+	var dropRatio float64
+	if to == StateOpen {
+		dropRatio = 1
+	}
+	notify(b.options.clock, b.name, b.options.observers, from, to, dropRatio)
+}
+
+// 释放半开探测名额
+func (b *stateBreaker) releaseProbe() {
+	if b.probes > 0 {
+		b.probes--
+	}
+}
+
+type statePromise struct {
+	b *stateBreaker
+	// 放行时的状态代数
+	generation uint64
+}
+
+// 正常请求计数
+func (p statePromise) Accept() {
+	p.b.markSuccess(p.generation, 1)
+}
+
+// 异常请求计数
+func (p statePromise) Reject(reason string) {
+	p.b.markFailure(p.generation, 1, reason)
+}
+
+// WithStateMachine lets the Breaker use a closed/open/half-open state machine
+// instead of the google sre throttling.
+// 使用状态机熔断器
+func WithStateMachine() BreakerOption {
+	return func(opts *breakerOptions) {
+		opts.stateMachine = true
+	}
+}
+
+// WithConsecutiveFailures customizes the state machine Breaker to open after n consecutive failures.
+// 连续失败 n 次后熔断
+func WithConsecutiveFailures(n int64) BreakerOption {
+	return func(opts *breakerOptions) {
+		opts.maxFailures = n
+	}
+}
+
+// WithFailureRatio customizes the state machine Breaker to open when the failure ratio
+// in the recent window reaches ratio.
+// 窗口内失败比例达到 ratio 后熔断
+func WithFailureRatio(ratio float64) BreakerOption {
+	return func(opts *breakerOptions) {
+		opts.failureRatio = ratio
+	}
+}
+
+// WithSleepWindow customizes how long the state machine Breaker stays open.
+// 熔断持续时间，之后进入半开状态
+func WithSleepWindow(window time.Duration) BreakerOption {
+	return func(opts *breakerOptions) {
+		opts.sleepWindow = window
+	}
+}
+
+// WithHalfOpenProbes customizes how many probe requests are allowed in half-open state.
+// 半开状态下允许通过的探测请求数
+func WithHalfOpenProbes(n int) BreakerOption {
+	return func(opts *breakerOptions) {
+		opts.halfOpenProbes = n
+	}
+}
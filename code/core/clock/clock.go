@@ -0,0 +1,75 @@
+package clock
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/zeromicro/go-zero/core/timex"
+)
+
+var (
+	// Real is the Clock backed by the monotonic time of timex.
+	// 默认时钟，使用 timex 的单调时间
+	Real Clock = realClock{}
+	// 相对时间 0 对应的墙上时间
+	epoch = time.Now().Add(-timex.Now())
+)
+
+type (
+	// A Clock provides the relative monotonic time, same as timex.Now and timex.Since.
+	// 时钟抽象，便于测试中手动推进时间
+	Clock interface {
+		// Now returns the relative time.
+		Now() time.Duration
+		// Since returns the elapsed time since d.
+		Since(d time.Duration) time.Duration
+	}
+
+	realClock struct{}
+
+	// A FakeClock is a Clock that only advances manually, used in tests.
+	// 手动推进的时钟，用于编写确定性的测试
+	FakeClock struct {
+		now int64
+	}
+)
+
+// NewFakeClock returns a FakeClock starting at the current time of Real,
+// so that the time is never zero, which means unset in many places.
+// 初始化手动时钟，从当前时间开始，避免出现表示未设置的 0 值
+func NewFakeClock() *FakeClock {
+	return &FakeClock{
+		now: int64(Real.Now()),
+	}
+}
+
+// Time returns the wall time of c, same as timex.Time for Real,
+// so that the timestamps from a FakeClock advance with it.
+// 时钟对应的墙上时间，Real 时钟等同于 timex.Time，手动时钟的时间随推进而变化
+func Time(c Clock) time.Time {
+	return epoch.Add(c.Now())
+}
+
+// Advance moves the FakeClock forward by d.
+// 推进时间
+func (c *FakeClock) Advance(d time.Duration) {
+	atomic.AddInt64(&c.now, int64(d))
+}
+
+// Now implements Clock.Now.
+func (c *FakeClock) Now() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.now))
+}
+
+// Since implements Clock.Since.
+func (c *FakeClock) Since(d time.Duration) time.Duration {
+	return c.Now() - d
+}
+
+func (realClock) Now() time.Duration {
+	return timex.Now()
+}
+
+func (realClock) Since(d time.Duration) time.Duration {
+	return timex.Since(d)
+}
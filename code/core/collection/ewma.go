@@ -0,0 +1,95 @@
+package collection
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+
+	"gozerosource/code/core/clock"
+)
+
+// 表示还没有添加过数据
+var unsetEWMA = math.Float64bits(math.NaN())
+
+// EWMA is an exponentially weighted moving average that decays continuously by time,
+// the weight of the old value is exp(-td/decay), td is the time since the last Add.
+// It's lock free, so that it can be used on the hot path like the p2c balancer.
+// 按时间连续衰减的指数加权移动平均值，无锁实现
+// 旧值的权重为 exp(-td/decay)，td 为距离上次添加的时间，p2c 用它计算节点的响应时间和健康值
+type EWMA struct {
+	decay time.Duration
+	// 当前值的 math.Float64bits，unsetEWMA 表示还没有添加过数据
+	value uint64
+	// 还没有添加过数据时的值
+	seed uint64
+	// 最后添加数据的时间
+	last  int64
+	clock clock.Clock
+}
+
+// NewEWMA returns an EWMA with given decay time, only WithClock is supported in opts.
+// 初始化 EWMA，opts 仅支持 WithClock
+func NewEWMA(decay time.Duration, opts ...RollingWindowOption) *EWMA {
+	return &EWMA{
+		decay: decay,
+		value: unsetEWMA,
+		clock: clockOf(opts),
+	}
+}
+
+// Seed sets the value before the first Add, the first Add still takes its value as is.
+// It should be called before the EWMA is shared.
+// 设置添加数据之前的值，第一个数据仍然直接作为当前值，需要在并发使用之前调用
+func (e *EWMA) Seed(v float64) {
+	atomic.StoreUint64(&e.seed, math.Float64bits(v))
+}
+
+// Add adds v into the EWMA, the first value is taken as is.
+// 添加数据，第一个数据直接作为当前值
+func (e *EWMA) Add(v float64) {
+	now := e.clock.Now()
+	last := time.Duration(atomic.SwapInt64(&e.last, int64(now)))
+	w := decayWeight(now-last, e.decay)
+	for {
+		old := atomic.LoadUint64(&e.value)
+		val := v
+		if old != unsetEWMA {
+			val = math.Float64frombits(old)*w + v*(1-w)
+		}
+		if atomic.CompareAndSwapUint64(&e.value, old, math.Float64bits(val)) {
+			return
+		}
+	}
+}
+
+// Value returns the current value of the EWMA, or the seed if nothing is added.
+// 当前值，没有添加过数据时返回 Seed 设置的值
+func (e *EWMA) Value() float64 {
+	val := atomic.LoadUint64(&e.value)
+	if val == unsetEWMA {
+		return math.Float64frombits(atomic.LoadUint64(&e.seed))
+	}
+
+	return math.Float64frombits(val)
+}
+
+// 经过 td 时间后旧数据的权重，即牛顿冷却定律中的衰减函数
+func decayWeight(td, decay time.Duration) float64 {
+	if td <= 0 {
+		return 1
+	}
+
+	return math.Exp(float64(-td) / float64(decay))
+}
+
+// 从 RollingWindowOption 中解析时钟
+func clockOf(opts []RollingWindowOption) clock.Clock {
+	rw := RollingWindow{
+		clock: clock.Real,
+	}
+	for _, opt := range opts {
+		opt(&rw)
+	}
+
+	return rw.clock
+}
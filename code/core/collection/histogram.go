@@ -0,0 +1,117 @@
+package collection
+
+import (
+	"math"
+	"sort"
+)
+
+// 每个 2 的幂区间划分的子桶数量，决定了分位数的相对误差（1/16 约 6%）
+const histogramSubBuckets = 16
+
+// 0 及负数所在的子桶下标，小于所有正数的下标
+const zeroIndex = math.MinInt32
+
+// Histogram is an HDR-style histogram with log-linear buckets,
+// the relative error of the quantiles is bounded by 1/16.
+// 直方图，按 2 的幂分段，每段再线性划分子桶，用于计算分位数
+// 稀疏存储，只记录出现过的子桶
+type Histogram struct {
+	Sum    float64 // 值之和
+	Count  int64   // 值的数量
+	counts map[int]int64
+}
+
+// NewHistogram returns an empty Histogram.
+func NewHistogram() *Histogram {
+	return &Histogram{
+		counts: make(map[int]int64),
+	}
+}
+
+// Add adds v into the Histogram, negative values are treated as 0,
+// positive values of any magnitude, including those below 1, keep the 1/16 relative error.
+// 添加数据
+func (h *Histogram) Add(v float64) {
+	h.Sum += v
+	h.Count++
+	h.counts[histogramIndex(v)]++
+}
+
+// Merge merges other into h.
+// 合并直方图
+func (h *Histogram) Merge(other *Histogram) {
+	h.Sum += other.Sum
+	h.Count += other.Count
+	for i, c := range other.counts {
+		h.counts[i] += c
+	}
+}
+
+// Quantile returns the value at quantile q, q is in [0, 1], e.g. 0.99 for p99.
+// Returns 0 if the Histogram is empty.
+// 计算分位数，返回所在子桶的中间值
+func (h *Histogram) Quantile(q float64) float64 {
+	if h.Count == 0 {
+		return 0
+	}
+
+	indexes := make([]int, 0, len(h.counts))
+	for i := range h.counts {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	// 分位数对应的排名，从 1 开始
+	rank := int64(math.Ceil(q * float64(h.Count)))
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for _, i := range indexes {
+		seen += h.counts[i]
+		if seen >= rank {
+			return histogramValue(i)
+		}
+	}
+
+	return histogramValue(indexes[len(indexes)-1])
+}
+
+// 重置
+func (h *Histogram) reset() {
+	h.Sum = 0
+	h.Count = 0
+	for i := range h.counts {
+		delete(h.counts, i)
+	}
+}
+
+// 计算值所在子桶的下标
+// 小于 1 的正数同样按 2 的幂分段，下标为负数；0 及负数统一放在 zeroIndex
+func histogramIndex(v float64) int {
+	if v <= 0 {
+		return zeroIndex
+	}
+
+	// v = frac * 2^exp, frac in [0.5, 1)
+	frac, exp := math.Frexp(v)
+	sub := int((frac*2 - 1) * histogramSubBuckets)
+	return (exp-1)*histogramSubBuckets + sub
+}
+
+// 子桶的中间值
+func histogramValue(index int) float64 {
+	if index == zeroIndex {
+		return 0
+	}
+
+	// 下标可能为负数，按向下取整拆分出 2 的幂和子桶
+	exp := index / histogramSubBuckets
+	sub := index % histogramSubBuckets
+	if sub < 0 {
+		exp--
+		sub += histogramSubBuckets
+	}
+	width := math.Ldexp(1, exp) / histogramSubBuckets
+	return math.Ldexp(1, exp) + (float64(sub)+0.5)*width
+}
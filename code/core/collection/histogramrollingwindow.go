@@ -0,0 +1,121 @@
+package collection
+
+import (
+	"sync"
+	"time"
+
+	"gozerosource/code/core/clock"
+)
+
+// HistogramRollingWindow is a rolling window whose buckets are histograms,
+// it's used to calculate the percentiles of the values in the window, such as p99 latency.
+// 直方图滑动窗口，每个桶是一个直方图，用于统计窗口内的分位数，比如 p99 响应时间
+type HistogramRollingWindow struct {
+	lock          sync.RWMutex
+	size          int
+	buckets       []*Histogram
+	interval      time.Duration
+	offset        int
+	ignoreCurrent bool
+	lastTime      time.Duration
+	clock         clock.Clock
+}
+
+// NewHistogramRollingWindow returns a HistogramRollingWindow that with size buckets and time interval.
+// Only IgnoreCurrentBucket and WithClock are supported in opts.
+// 初始化直方图滑动窗口，opts 仅支持 IgnoreCurrentBucket 和 WithClock
+func NewHistogramRollingWindow(size int, interval time.Duration,
+	opts ...RollingWindowOption,
+) *HistogramRollingWindow {
+	if size < 1 {
+		panic("size must be greater than 0")
+	}
+
+	// 复用 RollingWindow 的选项
+	rw := RollingWindow{
+		clock: clock.Real,
+	}
+	for _, opt := range opts {
+		opt(&rw)
+	}
+	buckets := make([]*Histogram, size)
+	for i := range buckets {
+		buckets[i] = NewHistogram()
+	}
+
+	return &HistogramRollingWindow{
+		size:          size,
+		buckets:       buckets,
+		interval:      interval,
+		ignoreCurrent: rw.ignoreCurrent,
+		lastTime:      rw.clock.Now(),
+		clock:         rw.clock,
+	}
+}
+
+// Add adds value to current bucket.
+// 添加数据
+func (hw *HistogramRollingWindow) Add(v float64) {
+	hw.lock.Lock()
+	defer hw.lock.Unlock()
+
+	hw.updateOffset()
+	hw.buckets[hw.offset].Add(v)
+}
+
+// Reduce runs fn on all buckets, ignore current bucket if ignoreCurrent was set.
+// 归纳汇总数据
+func (hw *HistogramRollingWindow) Reduce(fn func(h *Histogram)) {
+	hw.lock.RLock()
+	defer hw.lock.RUnlock()
+
+	var diff int
+	span := hw.span()
+	if span == 0 && hw.ignoreCurrent {
+		diff = hw.size - 1
+	} else {
+		diff = hw.size - span
+	}
+	offset := hw.offset + span + 1
+	for i := 0; i < diff; i++ {
+		fn(hw.buckets[(offset+i)%hw.size])
+	}
+}
+
+// Percentile returns the value at percentile p of all the values in the window, p is in [0, 100].
+// 计算窗口内所有数据的分位数，比如 Percentile(99) 为 p99
+func (hw *HistogramRollingWindow) Percentile(p float64) float64 {
+	merged := NewHistogram()
+	hw.Reduce(func(h *Histogram) {
+		merged.Merge(h)
+	})
+
+	return merged.Quantile(p / 100)
+}
+
+// 计算当前距离最后写入数据经过多少个桶
+func (hw *HistogramRollingWindow) span() int {
+	offset := int(hw.clock.Since(hw.lastTime) / hw.interval)
+	if 0 <= offset && offset < hw.size {
+		return offset
+	}
+
+	return hw.size
+}
+
+// 更新当前时间的游标，清空过期的桶
+func (hw *HistogramRollingWindow) updateOffset() {
+	span := hw.span()
+	if span <= 0 {
+		return
+	}
+
+	offset := hw.offset
+	for i := 0; i < span; i++ {
+		hw.buckets[(offset+i+1)%hw.size].reset()
+	}
+	hw.offset = (offset + span) % hw.size
+	now := hw.clock.Now()
+	// align to interval time boundary
+	hw.lastTime = now - (now-hw.lastTime)%hw.interval
+}
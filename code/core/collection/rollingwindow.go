@@ -4,7 +4,7 @@ import (
 	"sync"
 	"time"
 
-	"github.com/zeromicro/go-zero/core/timex"
+	"gozerosource/code/core/clock"
 )
 
 type (
@@ -26,6 +26,8 @@ type (
 		// 用于计算下一次写入数据间隔最后一次写入数据的之间
 		// 经过了多少个时间间隔
 		lastTime time.Duration // start time of the last bucket
+		// 时钟，测试时可替换为手动推进的时钟
+		clock clock.Clock
 	}
 )
 
@@ -40,11 +42,12 @@ func NewRollingWindow(size int, interval time.Duration, opts ...RollingWindowOpt
 		size:     size,
 		win:      newWindow(size),
 		interval: interval,
-		lastTime: timex.Now(),
+		clock:    clock.Real,
 	}
 	for _, opt := range opts {
 		opt(w)
 	}
+	w.lastTime = w.clock.Now()
 	return w
 }
 
@@ -58,6 +61,17 @@ func (rw *RollingWindow) Add(v float64) {
 	rw.win.add(rw.offset, v) // 添加数据
 }
 
+// AddN adds v to the sum and n to the count of current bucket,
+// it's used to record weighted values.
+// 添加带权重的数据，v 计入总和，n 计入次数
+func (rw *RollingWindow) AddN(v float64, n int64) {
+	rw.lock.Lock()
+	defer rw.lock.Unlock()
+
+	rw.updateOffset()
+	rw.win.addN(rw.offset, v, n)
+}
+
 // Reduce runs fn on all buckets, ignore current bucket if ignoreCurrent was set.
 // 归纳汇总数据
 func (rw *RollingWindow) Reduce(fn func(b *Bucket)) {
@@ -84,7 +98,7 @@ func (rw *RollingWindow) Reduce(fn func(b *Bucket)) {
 // 计算当前距离最后写入数据经过多少个单元时间间隔
 // 实际上指的就是经过多少个桶
 func (rw *RollingWindow) span() int {
-	offset := int(timex.Since(rw.lastTime) / rw.interval)
+	offset := int(rw.clock.Since(rw.lastTime) / rw.interval)
 	if 0 <= offset && offset < rw.size {
 		return offset
 	}
@@ -114,7 +128,7 @@ func (rw *RollingWindow) updateOffset() {
 	}
 	// 更新offset
 	rw.offset = (offset + span) % rw.size
-	now := timex.Now()
+	now := rw.clock.Now()
 	// align to interval time boundary
 	// 更新操作时间(当前时间-上次时间余数)
 	rw.lastTime = now - (now-rw.lastTime)%rw.interval
@@ -133,6 +147,12 @@ func (b *Bucket) add(v float64) {
 	b.Count++  // 次数+1
 }
 
+// 添加带权重的数据
+func (b *Bucket) addN(v float64, n int64) {
+	b.Sum += v
+	b.Count += n
+}
+
 // 桶重置
 func (b *Bucket) reset() {
 	b.Sum = 0
@@ -164,6 +184,11 @@ func (w *window) add(offset int, v float64) {
 	w.buckets[offset%w.size].add(v)
 }
 
+// 添加带权重的数据
+func (w *window) addN(offset int, v float64, n int64) {
+	w.buckets[offset%w.size].addN(v, n)
+}
+
 // 汇总数据
 // fn 自定义的bucket统计函数
 func (w *window) reduce(start, count int, fn func(b *Bucket)) {
@@ -184,3 +209,11 @@ func IgnoreCurrentBucket() RollingWindowOption {
 		w.ignoreCurrent = true
 	}
 }
+
+// WithClock lets the RollingWindow use the given Clock, mostly used in tests.
+// 设置时钟，用于测试
+func WithClock(c clock.Clock) RollingWindowOption {
+	return func(w *RollingWindow) {
+		w.clock = c
+	}
+}
@@ -0,0 +1,151 @@
+package collection
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gozerosource/code/core/clock"
+)
+
+// 缓存行大小，用于避免分片之间的伪共享
+const cacheLineSize = 64
+
+type (
+	// ShardedRollingWindow is a RollingWindow split into shards to reduce lock contention
+	// on Add, Reduce merges the buckets of all shards by time.
+	// It's suitable for the scenarios with frequent Add and infrequent Reduce.
+	// 分片滑动窗口，Add 分散到多个分片以降低锁竞争，Reduce 时按时间合并所有分片的桶
+	// 适用于写多读少的场景
+	ShardedRollingWindow struct {
+		shards []paddedRollingWindow
+		mask   uint32
+		// 每个 P 缓存一个分片下标，Add 时无需写共享变量
+		hints sync.Pool
+		// 仅在创建新的分片下标时轮询分配
+		next uint32
+		// 所有分片共同的起始时间，用于对齐各分片的桶
+		start         time.Duration
+		size          int
+		interval      time.Duration
+		ignoreCurrent bool
+		clock         clock.Clock
+	}
+
+	paddedRollingWindow struct {
+		RollingWindow
+		_ [cacheLineSize]byte
+	}
+)
+
+// NewShardedRollingWindow returns a ShardedRollingWindow with the same semantics as RollingWindow,
+// the number of shards is GOMAXPROCS rounded up to a power of two.
+// 初始化分片滑动窗口，分片数为 GOMAXPROCS 向上取 2 的幂
+func NewShardedRollingWindow(size int, interval time.Duration,
+	opts ...RollingWindowOption,
+) *ShardedRollingWindow {
+	if size < 1 {
+		panic("size must be greater than 0")
+	}
+
+	n := 1
+	for n < runtime.GOMAXPROCS(0) {
+		n <<= 1
+	}
+	// 先解析选项，所有分片共用同一个时钟
+	rw := RollingWindow{
+		clock: clock.Real,
+	}
+	for _, opt := range opts {
+		opt(&rw)
+	}
+	start := rw.clock.Now()
+	sw := &ShardedRollingWindow{
+		shards:        make([]paddedRollingWindow, n),
+		mask:          uint32(n - 1),
+		start:         start,
+		size:          size,
+		interval:      interval,
+		ignoreCurrent: rw.ignoreCurrent,
+		clock:         rw.clock,
+	}
+	sw.hints.New = func() interface{} {
+		hint := atomic.AddUint32(&sw.next, 1) & sw.mask
+		return &hint
+	}
+	for i := range sw.shards {
+		shard := &sw.shards[i].RollingWindow
+		*shard = RollingWindow{
+			size:          size,
+			win:           newWindow(size),
+			interval:      interval,
+			lastTime:      start,
+			ignoreCurrent: rw.ignoreCurrent,
+			clock:         rw.clock,
+		}
+	}
+
+	return sw
+}
+
+// Add adds value to current bucket.
+// 添加数据
+func (sw *ShardedRollingWindow) Add(v float64) {
+	hint := sw.hints.Get().(*uint32)
+	sw.shards[*hint].Add(v)
+	sw.hints.Put(hint)
+}
+
+// AddN adds v to the sum and n to the count of current bucket.
+// 添加带权重的数据
+func (sw *ShardedRollingWindow) AddN(v float64, n int64) {
+	hint := sw.hints.Get().(*uint32)
+	sw.shards[*hint].AddN(v, n)
+	sw.hints.Put(hint)
+}
+
+// Reduce runs fn on all buckets merged from the shards, ignore current bucket if ignoreCurrent was set.
+// 按时间合并所有分片的桶后汇总数据
+func (sw *ShardedRollingWindow) Reduce(fn func(b *Bucket)) {
+	// 当前时间所在的桶序号，所有分片共用同一时间轴
+	current := int64((sw.clock.Now() - sw.start) / sw.interval)
+	lowest := current - int64(sw.size) + 1
+	merged := make([]Bucket, sw.size)
+	latest := lowest - 1
+
+	for i := range sw.shards {
+		shard := &sw.shards[i].RollingWindow
+		shard.lock.RLock()
+		// 分片最后写入的桶序号
+		last := int64((shard.lastTime - sw.start) / sw.interval)
+		if last > latest {
+			latest = last
+		}
+		// 分片中未过期的桶，序号为 [last-size+1, last]
+		for slot := last - int64(shard.size) + 1; slot <= last; slot++ {
+			// 跳过已过期的桶，以及汇总期间新写入的桶
+			if slot < lowest || slot > current {
+				continue
+			}
+			// 分片的游标对应最后写入的桶，往前推算对应桶的下标
+			index := (shard.offset - int(last-slot) + shard.size) % shard.size
+			b := shard.win.buckets[index]
+			merged[slot-lowest].addN(b.Sum, b.Count)
+		}
+		shard.lock.RUnlock()
+	}
+
+	// 与 RollingWindow 一致：只汇总到最后写入的桶为止
+	// 忽略当前桶时，如果最后写入的桶就是当前桶则跳过
+	end := latest
+	if end > current {
+		end = current
+	}
+	if end == current && sw.ignoreCurrent {
+		end--
+	}
+	for slot := lowest; slot <= end; slot++ {
+		fn(&merged[slot-lowest])
+	}
+}
@@ -0,0 +1,122 @@
+package limit
+
+import (
+	"errors"
+	"time"
+
+	"github.com/zeromicro/go-zero/core/collection"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+	xrate "golang.org/x/time/rate"
+)
+
+const (
+	// 按 key 限流的令牌桶在进程内至少缓存的时间
+	minTokenKeyExpiry = time.Minute
+	// redis故障时最多为多少个 key 保留进程内限流器，超过时淘汰最久未使用的
+	maxRescueKeys = 10000
+)
+
+// ErrInvalidRate is an error that represents the rate or burst is not positive.
+var ErrInvalidRate = errors.New("rate and burst must be positive")
+
+type (
+	// A KeyLimiter limits the requests by key, like the client ip or the user id.
+	// PeriodLimit, SlidingLimit and TokenKeyLimiter implement it.
+	// 按 key 限流，比如客户端 ip 或者用户 id
+	KeyLimiter interface {
+		TakeResult(key string) (Result, error)
+	}
+
+	// KeyLimiterFunc is an adapter to allow the use of ordinary functions as KeyLimiters.
+	// 函数形式的 KeyLimiter
+	KeyLimiterFunc func(key string) (Result, error)
+
+	// A TokenKeyLimiter is a KeyLimiter that holds a TokenLimiter for each key.
+	// All the keys share one redis health monitor and the in-process limiters for rescue.
+	// 每个 key 使用一个令牌桶限流，所有 key 共享redis健康探测及兜底的进程内限流器
+	TokenKeyLimiter struct {
+		rate      int
+		burst     int
+		store     *redis.Redis
+		keyPrefix string
+		opts      []TokenLimiterOption
+		// 缓存各 key 的 TokenLimiter，长时间未使用时淘汰
+		limiters *collection.Cache
+		monitor  *redisMonitor
+		rescues  *rescueLimiters
+	}
+
+	// redis故障时各 key 使用的进程内限流器，数量有上限
+	rescueLimiters struct {
+		rate     int
+		burst    int
+		limiters *collection.Cache
+	}
+)
+
+// TakeResult implements KeyLimiter.TakeResult.
+func (f KeyLimiterFunc) TakeResult(key string) (Result, error) {
+	return f(key)
+}
+
+// NewTokenKeyLimiter returns a TokenKeyLimiter, each key allows events up to rate
+// and permits bursts of at most burst tokens, ErrInvalidRate is returned if rate or burst is not positive.
+// 初始化按 key 限流的令牌桶限流器，rate 和 burst 必须大于 0
+func NewTokenKeyLimiter(rate, burst int, store *redis.Redis, keyPrefix string,
+	opts ...TokenLimiterOption,
+) (*TokenKeyLimiter, error) {
+	if rate <= 0 || burst <= 0 {
+		return nil, ErrInvalidRate
+	}
+
+	// 令牌桶在 redis 中的过期时间为填满时间的2倍，进程内至少缓存同样长的时间
+	expiry := time.Duration(burst) * time.Second * 2 / time.Duration(rate)
+	if expiry < minTokenKeyExpiry {
+		expiry = minTokenKeyExpiry
+	}
+	limiters, err := collection.NewCache(expiry)
+	if err != nil {
+		return nil, err
+	}
+	rescues, err := collection.NewCache(expiry, collection.WithLimit(maxRescueKeys))
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenKeyLimiter{
+		rate:      rate,
+		burst:     burst,
+		store:     store,
+		keyPrefix: keyPrefix,
+		opts:      opts,
+		limiters:  limiters,
+		monitor:   newRedisMonitor(store),
+		rescues: &rescueLimiters{
+			rate:     rate,
+			burst:    burst,
+			limiters: rescues,
+		},
+	}, nil
+}
+
+// TakeResult implements KeyLimiter.TakeResult.
+func (l *TokenKeyLimiter) TakeResult(key string) (Result, error) {
+	val, err := l.limiters.Take(key, func() (interface{}, error) {
+		limiter := newTokenLimiter(l.rate, l.burst, l.store, l.keyPrefix+key, l.monitor, l.opts...)
+		limiter.rescues = l.rescues
+		return limiter, nil
+	})
+	if err != nil {
+		return Result{}, err
+	}
+
+	return val.(*TokenLimiter).TakeResult(time.Now(), 1), nil
+}
+
+// 获取 key 的进程内限流器，只在redis故障时创建
+func (r *rescueLimiters) get(key string) *xrate.Limiter {
+	val, _ := r.limiters.Take(key, func() (interface{}, error) {
+		return newRescueLimiter(r.rate, r.burst), nil
+	})
+	return val.(*xrate.Limiter)
+}
@@ -13,25 +13,33 @@ import (
 -- KYES[1]:限流器key
 -- ARGV[1]:qos,单位时间内最多请求次数
 -- ARGV[2]:单位限流窗口时间
+-- 返回 {状态, 剩余请求数, 窗口重置时间, 重试等待时间}，时间单位为毫秒
 -- 请求最大次数,等于p.quota
 local limit = tonumber(ARGV[1])
 -- 窗口即一个单位限流周期,这里用过期模拟窗口效果,等于p.permit
 local window = tonumber(ARGV[2])
 -- 请求次数+1,获取请求总数
 local current = redis.call("INCRBY",KYES[1],1)
--- 如果是第一次请求,则设置过期时间并返回 成功
+-- 如果是第一次请求,则设置过期时间
 if current == 1 then
   redis.call("expire",KYES[1],window)
-  return 1
--- 如果当前请求数量<limit则返回 成功
-elseif current < limit then
-  return 1
+end
+-- 窗口剩余时间即重置时间
+local ttl = redis.call("pttl",KYES[1])
+if ttl < 0 then
+  ttl = window*1000
+end
+-- 剩余请求数
+local remaining = math.max(0, limit-current)
+-- 如果是第一次请求或者当前请求数量<limit则返回 成功
+if current == 1 or current < limit then
+  return {1, remaining, ttl, 0}
 -- 如果当前请求数量==limit则返回 最后一次请求
 elseif current == limit then
-  return 2
--- 请求数量>limit则返回 失败
+  return {2, remaining, ttl, 0}
+-- 请求数量>limit则返回 失败，窗口重置后才能重试
 else
-  return 0
+  return {0, remaining, ttl, ttl}
 end
 
 */
@@ -42,13 +50,18 @@ local window = tonumber(ARGV[2])
 local current = redis.call("INCRBY", KEYS[1], 1)
 if current == 1 then
     redis.call("expire", KEYS[1], window)
-    return 1
-elseif current < limit then
-    return 1
+end
+local ttl = redis.call("pttl", KEYS[1])
+if ttl < 0 then
+    ttl = window*1000
+end
+local remaining = math.max(0, limit-current)
+if current == 1 or current < limit then
+    return {1, remaining, ttl, 0}
 elseif current == limit then
-    return 2
+    return {2, remaining, ttl, 0}
 else
-    return 0
+    return {0, remaining, ttl, ttl}
 end`
 
 const (
@@ -114,30 +127,22 @@ func NewPeriodLimit(period, quota int, limitStore *redis.Redis, keyPrefix string
 // 2：允许但是当前窗口内已到达上限
 // 3：拒绝
 func (h *PeriodLimit) Take(key string) (int, error) {
-	// 执行lua脚本
-	resp, err := h.limitStore.Eval(periodScript, []string{h.keyPrefix + key}, []string{
-		strconv.Itoa(h.quota),
-		strconv.Itoa(h.calcExpireSeconds()),
-	})
+	result, err := h.TakeResult(key)
 	if err != nil {
 		return Unknown, err
 	}
 
-	code, ok := resp.(int64)
-	if !ok {
-		return Unknown, ErrUnknownCode
-	}
+	return result.State, nil
+}
 
-	switch code {
-	case internalOverQuota:
-		return OverQuota, nil
-	case internalAllowed:
-		return Allowed, nil
-	case internalHitQuota:
-		return HitQuota, nil
-	default:
-		return Unknown, ErrUnknownCode
-	}
+// TakeResult requests a permit, it returns the detailed Result.
+// 执行限流，返回剩余请求数及窗口重置时间
+func (h *PeriodLimit) TakeResult(key string) (Result, error) {
+	// 执行lua脚本
+	return evalResult(h.limitStore, periodScript, []string{h.keyPrefix + key}, []string{
+		strconv.Itoa(h.quota),
+		strconv.Itoa(h.calcExpireSeconds()),
+	}, h.quota)
 }
 
 // 计算过期时间也就是窗口时间大小
@@ -0,0 +1,114 @@
+package limit
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/zeromicro/go-zero/core/stores/redis"
+	xrate "golang.org/x/time/rate"
+)
+
+// A Result is the detailed result of taking a permit from a limiter,
+// it's used to emit the X-RateLimit-Limit, X-RateLimit-Remaining and Retry-After headers.
+// 限流结果详情，可用于输出 X-RateLimit-Limit、X-RateLimit-Remaining 及 Retry-After 响应头
+type Result struct {
+	// State is one of Allowed, HitQuota and OverQuota.
+	// 限流状态
+	State int
+	// Limit is the quota of a period, or the burst of a TokenLimiter.
+	// 请求上限，TokenLimiter 为桶容量
+	Limit int
+	// Remaining is the number of requests that can be allowed right now.
+	// 当前还可以放行的请求数
+	Remaining int
+	// ResetAfter is the duration until the quota is fully reset.
+	// 距离配额完全恢复的时间
+	ResetAfter time.Duration
+	// RetryAfter is the duration until the request can be allowed, 0 if allowed.
+	// 距离请求可以被放行的时间，放行时为 0
+	RetryAfter time.Duration
+}
+
+// Allowed returns whether the request is allowed.
+// 是否放行
+func (r Result) Allowed() bool {
+	return r.State == Allowed || r.State == HitQuota
+}
+
+// FormatSeconds formats d in seconds rounded up, like the Retry-After header,
+// ok is false if d is infinite, e.g. the RetryAfter of a request that exceeds the burst.
+// 格式化为向上取整的秒数，d 为无穷大时返回 false，比如请求数量超过桶容量永远无法放行时
+func FormatSeconds(d time.Duration) (string, bool) {
+	if d == xrate.InfDuration {
+		return "", false
+	}
+	if d <= 0 {
+		return "0", true
+	}
+
+	// 先除后进位，避免 d 接近最大值时溢出
+	secs := int64(d / time.Second)
+	if d%time.Second > 0 {
+		secs++
+	}
+
+	return strconv.FormatInt(secs, 10), true
+}
+
+// 解析脚本返回的 {code, remaining, reset_after, retry_after}，时间单位为毫秒
+func parseResult(resp interface{}, limit int) (Result, error) {
+	ints, ok := parseInts(resp)
+	if !ok || len(ints) != 4 {
+		return Result{}, ErrUnknownCode
+	}
+
+	var state int
+	switch ints[0] {
+	case internalOverQuota:
+		state = OverQuota
+	case internalAllowed:
+		state = Allowed
+	case internalHitQuota:
+		state = HitQuota
+	default:
+		return Result{}, ErrUnknownCode
+	}
+
+	return Result{
+		State:      state,
+		Limit:      limit,
+		Remaining:  int(ints[1]),
+		ResetAfter: time.Duration(ints[2]) * time.Millisecond,
+		RetryAfter: time.Duration(ints[3]) * time.Millisecond,
+	}, nil
+}
+
+// 执行脚本并解析限流结果
+func evalResult(store *redis.Redis, script string, keys, args []string, limit int) (Result, error) {
+	resp, err := store.Eval(script, keys, args)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return parseResult(resp, limit)
+}
+
+// 解析脚本返回的整数数组
+func parseInts(resp interface{}) ([]int64, bool) {
+	vals, ok := resp.([]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	ints := make([]int64, len(vals))
+	for i, val := range vals {
+		v, ok := val.(int64)
+		if !ok {
+			return nil, false
+		}
+
+		ints[i] = v
+	}
+
+	return ints, true
+}
@@ -0,0 +1,153 @@
+package limit
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+/*
+
+-- KEYS[1]:限流器key，hash 结构，field 为窗口序号，value 为窗口内的请求数
+-- ARGV[1]:单位时间内最多请求次数
+-- ARGV[2]:窗口大小，单位毫秒
+-- ARGV[3]:当前时间戳，单位毫秒
+-- 返回 {状态, 剩余请求数, 重置时间, 重试等待时间}，时间单位为毫秒
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+-- 当前窗口及上一个窗口的序号
+local current = math.floor(now/window)
+local previous = current - 1
+-- 当前窗口已经过去的时间
+local elapsed = now - current*window
+-- 上一个窗口仍在滑动窗口内的比例
+local weight = (window - elapsed)/window
+local last = tonumber(redis.call("HGET", KEYS[1], previous))
+if last == nil then
+    last = 0
+end
+local count = tonumber(redis.call("HGET", KEYS[1], current))
+if count == nil then
+    count = 0
+end
+-- 按比例估算滑动窗口内的请求数，加上本次请求
+local estimated = math.floor(last*weight) + count + 1
+-- 超过上限时拒绝，被拒绝的请求不计数
+if estimated > limit then
+    -- 当前窗口的请求全部滑出窗口后重置，当前窗口没有请求时上一个窗口滑出即可
+    local reset = window - elapsed
+    if count > 0 then
+        reset = reset + window
+    end
+    local retry
+    if count >= limit then
+        -- 当前窗口已满，需要等到下一个窗口中 count*weight < limit
+        retry = window - elapsed + math.floor(window*(1 - limit/count)) + 1
+    else
+        -- 需要等到 last*weight < limit-count
+        retry = math.floor(window*(1 - (limit-count)/last)) - elapsed + 1
+    end
+    return {0, 0, reset, math.max(1, retry)}
+end
+
+redis.call("HINCRBY", KEYS[1], current, 1)
+-- 删除过期的窗口
+redis.call("HDEL", KEYS[1], previous - 1)
+-- 保留两个窗口
+redis.call("PEXPIRE", KEYS[1], window*2)
+-- 等于上限时返回 最后一次请求
+local code = 1
+if estimated == limit then
+    code = 2
+end
+
+return {code, limit - estimated, 2*window - elapsed, 0}
+
+*/
+
+// to be compatible with aliyun redis, we cannot use `local key = KEYS[1]` to reuse the key
+const slidingScript = `local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local current = math.floor(now/window)
+local previous = current - 1
+local elapsed = now - current*window
+local weight = (window - elapsed)/window
+local last = tonumber(redis.call("HGET", KEYS[1], previous))
+if last == nil then
+    last = 0
+end
+local count = tonumber(redis.call("HGET", KEYS[1], current))
+if count == nil then
+    count = 0
+end
+local estimated = math.floor(last*weight) + count + 1
+if estimated > limit then
+    local reset = window - elapsed
+    if count > 0 then
+        reset = reset + window
+    end
+    local retry
+    if count >= limit then
+        retry = window - elapsed + math.floor(window*(1 - limit/count)) + 1
+    else
+        retry = math.floor(window*(1 - (limit-count)/last)) - elapsed + 1
+    end
+    return {0, 0, reset, math.max(1, retry)}
+end
+
+redis.call("HINCRBY", KEYS[1], current, 1)
+redis.call("HDEL", KEYS[1], previous - 1)
+redis.call("PEXPIRE", KEYS[1], window*2)
+local code = 1
+if estimated == limit then
+    code = 2
+end
+
+return {code, limit - estimated, 2*window - elapsed, 0}`
+
+// A SlidingLimit is used to limit requests during a sliding period of time.
+// It weights the count of the previous window by its overlap with the sliding window,
+// so it doesn't allow 2x quota across the window boundary like PeriodLimit.
+// 滑动窗口限流器，使用上一个窗口和当前窗口的计数按比例估算滑动窗口内的请求数
+// 相比固定窗口，不会在窗口边界处放过两倍的请求
+type SlidingLimit struct {
+	period     int          // 窗口大小，单位s
+	quota      int          // 请求上限
+	limitStore *redis.Redis // 存储
+	keyPrefix  string       // key前缀
+}
+
+// NewSlidingLimit returns a SlidingLimit with given parameters.
+func NewSlidingLimit(period, quota int, limitStore *redis.Redis, keyPrefix string) *SlidingLimit {
+	return &SlidingLimit{
+		period:     period,
+		quota:      quota,
+		limitStore: limitStore,
+		keyPrefix:  keyPrefix,
+	}
+}
+
+// Take requests a permit, it returns the permit state, the same as PeriodLimit.Take.
+// The rejected requests are not counted.
+// 执行限流，返回值与 PeriodLimit.Take 一致，被拒绝的请求不计数
+func (h *SlidingLimit) Take(key string) (int, error) {
+	result, err := h.TakeResult(key)
+	if err != nil {
+		return Unknown, err
+	}
+
+	return result.State, nil
+}
+
+// TakeResult requests a permit, it returns the detailed Result.
+// 执行限流，返回剩余请求数、重置时间及重试等待时间
+func (h *SlidingLimit) TakeResult(key string) (Result, error) {
+	return evalResult(h.limitStore, slidingScript, []string{h.keyPrefix + key}, []string{
+		strconv.Itoa(h.quota),
+		strconv.FormatInt((time.Duration(h.period) * time.Second).Milliseconds(), 10),
+		strconv.FormatInt(time.Now().UnixMilli(), 10),
+	}, h.quota)
+}
@@ -1,7 +1,9 @@
 package limit
 
 import (
+	"context"
 	"fmt"
+	"math"
 	"strconv"
 	"sync"
 	"sync/atomic"
@@ -14,20 +16,30 @@ import (
 
 /*
 
--- 返回是否可以活获得预期的token
+-- 预定token，返回 {需要等待的毫秒数, 剩余token数, 桶填满的毫秒数, 重试等待的毫秒数}
+-- 需要等待的毫秒数为-1表示无法预定，重试等待的毫秒数为-1表示永远无法放行
 每秒生成token数量即token生成速度
 local rate = tonumber(ARGV[1])
 -- 桶容量
 local capacity = tonumber(ARGV[2])
--- 当前时间戳
+-- 当前时间戳，单位毫秒
 local now = tonumber(ARGV[3])
 -- 当前请求token数量
 local requested = tonumber(ARGV[4])
+-- 最多等待的毫秒数，-1表示不限制
+local max_wait = tonumber(ARGV[5])
 
--- fill_time：填满 token_bucket 需要多久
+-- 时间戳为负数时使用redis服务端时间，避免各节点时钟不一致
+if now < 0 then
+    -- TIME 是非确定性命令，需要按命令复制而不是按脚本复制，redis 5 之前需要显式开启
+    redis.replicate_commands()
+    local time = redis.call("TIME")
+    -- TIME 返回秒和微秒
+    now = tonumber(time[1])*1000 + math.floor(tonumber(time[2])/1000)
+end
+
+-- fill_time：填满 token_bucket 需要多久，单位秒
 local fill_time = capacity/rate
--- 向下取整,ttl为填满时间的2倍
-local ttl = math.floor(fill_time*2)
 -- 当前时间桶容量
 -- 获取目前 token_bucket 中剩余 token 数
 -- 如果是第一次进入，则设置 token_bucket 数量为 令牌桶最大值
@@ -44,27 +56,60 @@ if last_refreshed == nil then
     last_refreshed = 0
 end
 
--- 距离上次请求的时间跨度
+-- 距离上次请求的时间跨度，单位毫秒
 local delta = math.max(0, now-last_refreshed)
 -- 通过当前时间与上一次更新时间的跨度，以及生产token的速率，计算出新的token数
+-- rate 为每秒生产速率，按毫秒计算，避免token按秒跳变
 -- 如果超过 max_burst，多余生产的token会被丢弃
-local filled_tokens = math.min(capacity, last_tokens+(delta*rate))
--- 本次请求token数量是否足够
-local allowed = filled_tokens >= requested
--- 桶剩余数量
-local new_tokens = filled_tokens
--- 允许本次token申请,计算剩余数量
-if allowed then
-    new_tokens = filled_tokens - requested
+local filled_tokens = math.min(capacity, last_tokens+(delta*rate/1000))
+-- 预定后的剩余token数，负数表示预支了未来的token
+local new_tokens = filled_tokens - requested
+-- 等待token生产出来需要的毫秒数
+local wait = 0
+if new_tokens < 0 then
+    wait = math.ceil(-new_tokens*1000/rate)
 end
+-- 请求数量不能超过桶容量，等待时间不能超过最多等待时间
+local allowed = requested <= capacity and (max_wait < 0 or wait <= max_wait)
+-- 重试等待时间
+local retry = 0
+-- 不允许本次token申请,桶剩余数量不变
+if not allowed then
+    new_tokens = filled_tokens
+    -- 请求数量超过桶容量时永远无法放行，否则需要等到token足够
+    retry = -1
+    if requested <= capacity then
+        retry = wait
+    end
+    wait = -1
+end
+-- 桶填满需要的毫秒数
+local reset = math.ceil((capacity-new_tokens)*1000/rate)
 
+-- 向上取整,ttl为填满时间的2倍加上等待时间,至少1秒
+local ttl = math.max(1, math.ceil(fill_time*2 + math.max(0, wait)/1000))
 -- 更新新的token数，以及更新时间
 -- 设置剩余token数量
 redis.call("setex", KEYS[1], ttl, new_tokens)
 --设置刷新时间
 redis.call("setex", KEYS[2], ttl, now)
 
-return allowed
+return {wait, math.floor(math.max(0, new_tokens)), reset, retry}
+
+-- 取消预定，归还token，不超过桶容量
+local capacity = tonumber(ARGV[1])
+local requested = tonumber(ARGV[2])
+local tokens = tonumber(redis.call("get", KEYS[1]))
+-- 保持原有的过期时间
+local ttl = redis.call("pttl", KEYS[1])
+-- token已过期，无需归还
+if tokens == nil or ttl <= 0 then
+    return 0
+end
+
+redis.call("psetex", KEYS[1], ttl, math.min(capacity, tokens+requested))
+
+return 1
 
 */
 
@@ -76,8 +121,14 @@ const (
 local capacity = tonumber(ARGV[2])
 local now = tonumber(ARGV[3])
 local requested = tonumber(ARGV[4])
+local max_wait = tonumber(ARGV[5])
+if now < 0 then
+    redis.replicate_commands()
+    local time = redis.call("TIME")
+    now = tonumber(time[1])*1000 + math.floor(tonumber(time[2])/1000)
+end
+
 local fill_time = capacity/rate
-local ttl = math.floor(fill_time*2)
 local last_tokens = tonumber(redis.call("get", KEYS[1]))
 if last_tokens == nil then
     last_tokens = capacity
@@ -89,49 +140,134 @@ if last_refreshed == nil then
 end
 
 local delta = math.max(0, now-last_refreshed)
-local filled_tokens = math.min(capacity, last_tokens+(delta*rate))
-local allowed = filled_tokens >= requested
-local new_tokens = filled_tokens
-if allowed then
-    new_tokens = filled_tokens - requested
+local filled_tokens = math.min(capacity, last_tokens+(delta*rate/1000))
+local new_tokens = filled_tokens - requested
+local wait = 0
+if new_tokens < 0 then
+    wait = math.ceil(-new_tokens*1000/rate)
+end
+
+local allowed = requested <= capacity and (max_wait < 0 or wait <= max_wait)
+local retry = 0
+if not allowed then
+    new_tokens = filled_tokens
+    retry = -1
+    if requested <= capacity then
+        retry = wait
+    end
+    wait = -1
 end
 
+local reset = math.ceil((capacity-new_tokens)*1000/rate)
+
+local ttl = math.max(1, math.ceil(fill_time*2 + math.max(0, wait)/1000))
 redis.call("setex", KEYS[1], ttl, new_tokens)
 redis.call("setex", KEYS[2], ttl, now)
 
-return allowed`
-	tokenFormat     = "{%s}.tokens"
-	timestampFormat = "{%s}.ts"
+return {wait, math.floor(math.max(0, new_tokens)), reset, retry}`
+	// KEYS[1] as tokens_key
+	cancelScript = `local capacity = tonumber(ARGV[1])
+local requested = tonumber(ARGV[2])
+local tokens = tonumber(redis.call("get", KEYS[1]))
+local ttl = redis.call("pttl", KEYS[1])
+if tokens == nil or ttl <= 0 then
+    return 0
+end
+
+redis.call("psetex", KEYS[1], ttl, math.min(capacity, tokens+requested))
+
+return 1`
+	tokenFormat = "{%s}.tokens"
+	// 时间戳的单位为毫秒，与按秒存储的旧 key {%s}.ts 区分开，避免新旧版本互相误读
+	timestampFormat = "{%s}.ts.ms"
 	pingInterval    = time.Millisecond * 100
+	// 使用redis服务端时间
+	redisTime = -1
+	// 不限制等待时间
+	infiniteWait = time.Duration(math.MaxInt64)
 )
 
-// A TokenLimiter controls how frequently events are allowed to happen with in one second.
-type TokenLimiter struct {
-	rate           int            // 每秒生产速率
-	burst          int            // 桶容量
-	store          *redis.Redis   // 存储容器
-	tokenKey       string         // redis key
-	timestampKey   string         // 桶刷新时间key
-	rescueLock     sync.Mutex     // lock
-	redisAlive     uint32         // redis健康标识
-	rescueLimiter  *xrate.Limiter // redis故障时采用进程内 令牌桶限流器
-	monitorStarted bool           // redis监控探测任务标识
-}
+type (
+	// TokenLimiterOption defines the method to customize a TokenLimiter.
+	TokenLimiterOption func(l *TokenLimiter)
+
+	// A TokenLimiter controls how frequently events are allowed to happen with in one second.
+	// The tokens are refilled in milliseconds, so the events are spread smoothly within a second.
+	// 分布式令牌桶限流器，按毫秒生产token
+	TokenLimiter struct {
+		rate          int             // 每秒生产速率
+		burst         int             // 桶容量
+		store         *redis.Redis    // 存储容器
+		tokenKey      string          // redis key
+		timestampKey  string          // 桶刷新时间key
+		monitor       *redisMonitor   // redis健康探测，按 key 限流时所有 key 共享
+		rescueLimiter *xrate.Limiter  // redis故障时采用进程内 令牌桶限流器
+		rescues       *rescueLimiters // 按 key 限流时共享的进程内限流器，此时 rescueLimiter 为空
+		redisTime     bool            // 是否使用redis服务端时间
+	}
+
+	// redis健康探测，故障期间只开启一个探测任务
+	redisMonitor struct {
+		store   *redis.Redis
+		lock    sync.Mutex
+		alive   uint32 // redis健康标识
+		started bool   // redis监控探测任务标识
+	}
+
+	// A Reservation holds information about events that are permitted by a TokenLimiter to happen after a delay.
+	// A Reservation may be canceled, which may enable the TokenLimiter to permit additional events.
+	// 预定结果，到达 timeToAct 后才能执行，可以取消并归还token
+	Reservation struct {
+		ok        bool
+		lim       *TokenLimiter
+		tokens    int
+		timeToAct time.Time
+		// redis故障时从进程内限流器预定
+		rescue *xrate.Reservation
+		// 限流结果详情
+		result Result
+	}
+)
 
 // NewTokenLimiter returns a new TokenLimiter that allows events up to rate and permits
 // bursts of at most burst tokens.
-func NewTokenLimiter(rate, burst int, store *redis.Redis, key string) *TokenLimiter {
-	tokenKey := fmt.Sprintf(tokenFormat, key)
-	timestampKey := fmt.Sprintf(timestampFormat, key)
+func NewTokenLimiter(rate, burst int, store *redis.Redis, key string,
+	opts ...TokenLimiterOption,
+) *TokenLimiter {
+	limiter := newTokenLimiter(rate, burst, store, key, newRedisMonitor(store), opts...)
+	limiter.rescueLimiter = newRescueLimiter(rate, burst)
+	return limiter
+}
 
-	return &TokenLimiter{
-		rate:          rate,
-		burst:         burst,
-		store:         store,
-		tokenKey:      tokenKey,
-		timestampKey:  timestampKey,
-		redisAlive:    1,
-		rescueLimiter: xrate.NewLimiter(xrate.Every(time.Second/time.Duration(rate)), burst),
+func newTokenLimiter(rate, burst int, store *redis.Redis, key string, monitor *redisMonitor,
+	opts ...TokenLimiterOption,
+) *TokenLimiter {
+	limiter := &TokenLimiter{
+		rate:         rate,
+		burst:        burst,
+		store:        store,
+		tokenKey:     fmt.Sprintf(tokenFormat, key),
+		timestampKey: fmt.Sprintf(timestampFormat, key),
+		monitor:      monitor,
+	}
+	for _, opt := range opts {
+		opt(limiter)
+	}
+
+	return limiter
+}
+
+func newRescueLimiter(rate, burst int) *xrate.Limiter {
+	return xrate.NewLimiter(xrate.Every(time.Second/time.Duration(rate)), burst)
+}
+
+// WithRedisTime returns a func to customize a TokenLimiter to use the redis server time
+// instead of the given time, to avoid the clock skew between the nodes.
+// The given time is still used by the in-process limiter when redis is down.
+// 使用redis服务端时间，避免各节点时钟不一致，redis故障时进程内限流器仍使用传入的时间
+func WithRedisTime() TokenLimiterOption {
+	return func(l *TokenLimiter) {
+		l.redisTime = true
 	}
 }
 
@@ -144,15 +280,100 @@ func (lim *TokenLimiter) Allow() bool {
 // Use this method if you intend to drop / skip events that exceed the rate.
 // Otherwise, use Reserve or Wait.
 func (lim *TokenLimiter) AllowN(now time.Time, n int) bool {
-	return lim.reserveN(now, n)
+	return lim.reserveN(now, n, 0).ok
+}
+
+// TakeResult reports whether n events may happen at time now like AllowN, with the detailed Result.
+// The Remaining and ResetAfter are 0 when the in-process limiter is used for rescue.
+// 与 AllowN 一致，返回剩余token数、桶填满时间及重试等待时间，redis故障时剩余token数及填满时间为 0
+func (lim *TokenLimiter) TakeResult(now time.Time, n int) Result {
+	return lim.reserveN(now, n, 0).result
+}
+
+// Reserve is shorthand for ReserveN(time.Now(), 1).
+func (lim *TokenLimiter) Reserve() *Reservation {
+	return lim.ReserveN(time.Now(), 1)
+}
+
+// ReserveN returns a Reservation that indicates how long the caller must wait before n events happen.
+// The TokenLimiter takes this Reservation into account when allowing future events.
+// The returned Reservation's OK() method returns false if n exceeds the burst or redis fails.
+// Use this method if you wish to wait and slow down in accordance with the rate limit without dropping events.
+// If you need to cancel the delay, use Wait instead.
+// To drop or skip events exceeding rate limit, use Allow instead.
+// 预定n个token，返回需要等待的时间，token不足时预支未来的token
+func (lim *TokenLimiter) ReserveN(now time.Time, n int) *Reservation {
+	return lim.reserveN(now, n, infiniteWait)
 }
 
-func (lim *TokenLimiter) reserveN(now time.Time, n int) bool {
+// Wait is shorthand for WaitN(ctx, 1).
+func (lim *TokenLimiter) Wait(ctx context.Context) error {
+	return lim.WaitN(ctx, 1)
+}
+
+// WaitN blocks until lim permits n events to happen.
+// It returns an error if n exceeds the burst, the Context is canceled,
+// or the expected wait time exceeds the Context's Deadline.
+// 阻塞直到获取n个token，超过 ctx 的截止时间时不会预定token
+func (lim *TokenLimiter) WaitN(ctx context.Context, n int) error {
+	if n > lim.burst {
+		return fmt.Errorf("rate: Wait(n=%d) exceeds limiter's burst %d", n, lim.burst)
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	now := time.Now()
+	maxWait := infiniteWait
+	if deadline, ok := ctx.Deadline(); ok {
+		maxWait = deadline.Sub(now)
+	}
+
+	r := lim.reserveN(now, n, maxWait)
+	if !r.ok {
+		return fmt.Errorf("rate: Wait(n=%d) would exceed context deadline", n)
+	}
+
+	delay := r.DelayFrom(now)
+	if delay == 0 {
+		return nil
+	}
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		// 取消预定，归还token，以便其他请求使用
+		r.Cancel()
+		return ctx.Err()
+	}
+}
+
+// 预定n个token，最多等待 maxWait
+func (lim *TokenLimiter) reserveN(now time.Time, n int, maxWait time.Duration) *Reservation {
 	// 判断redis是否健康
 	// redis故障时采用进程内限流器
 	// 兜底保障
-	if atomic.LoadUint32(&lim.redisAlive) == 0 {
-		return lim.rescueLimiter.AllowN(now, n)
+	if !lim.monitor.isAlive() {
+		return lim.rescueReserveN(now, n, maxWait)
+	}
+	// 时间戳单位为毫秒
+	ts := now.UnixMilli()
+	if lim.redisTime {
+		ts = redisTime
+	}
+	// 截止时间已过时不等待，脚本中 -1 表示不限制等待时间
+	if maxWait < 0 {
+		maxWait = 0
+	}
+	waitMillis := int64(-1)
+	if maxWait < infiniteWait {
+		waitMillis = maxWait.Milliseconds()
 	}
 	// 执行脚本获取令牌
 	resp, err := lim.store.Eval(
@@ -164,66 +385,222 @@ func (lim *TokenLimiter) reserveN(now time.Time, n int) bool {
 		[]string{
 			strconv.Itoa(lim.rate),
 			strconv.Itoa(lim.burst),
-			strconv.FormatInt(now.Unix(), 10),
+			strconv.FormatInt(ts, 10),
 			strconv.Itoa(n),
+			strconv.FormatInt(waitMillis, 10),
 		})
-	// redis allowed == false
-	// Lua boolean false -> r Nil bulk reply
 	// 特殊处理key不存在的情况
 	if err == redis.Nil {
-		return false
+		return lim.overQuota(xrate.InfDuration)
 	}
 	if err != nil {
 		logx.Errorf("fail to use rate limiter: %s, use in-process limiter for rescue", err)
 		// 执行异常，开启redis健康探测任务
 		// 同时采用进程内限流器作为兜底
-		lim.startMonitor()
-		return lim.rescueLimiter.AllowN(now, n)
+		lim.monitor.start()
+		return lim.rescueReserveN(now, n, maxWait)
 	}
 
-	code, ok := resp.(int64)
-	if !ok {
+	vals, ok := parseInts(resp)
+	if !ok || len(vals) != 4 {
 		logx.Errorf("fail to eval redis script: %v, use in-process limiter for rescue", resp)
-		lim.startMonitor()
-		return lim.rescueLimiter.AllowN(now, n)
+		lim.monitor.start()
+		return lim.rescueReserveN(now, n, maxWait)
+	}
+
+	wait, remaining, reset, retry := vals[0], vals[1], vals[2], vals[3]
+	// -1 表示无法预定
+	if wait < 0 {
+		r := lim.overQuota(xrate.InfDuration)
+		if retry >= 0 {
+			r.result.RetryAfter = time.Duration(retry) * time.Millisecond
+		}
+		r.result.ResetAfter = time.Duration(reset) * time.Millisecond
+		r.result.Remaining = int(remaining)
+		return r
 	}
 
-	// redis allowed == true
-	// Lua boolean true -> r integer reply with value of 1
-	return code == 1
+	state := Allowed
+	if remaining == 0 {
+		state = HitQuota
+	}
+
+	return &Reservation{
+		ok:        true,
+		lim:       lim,
+		tokens:    n,
+		timeToAct: now.Add(time.Duration(wait) * time.Millisecond),
+		result: Result{
+			State:      state,
+			Limit:      lim.burst,
+			Remaining:  int(remaining),
+			ResetAfter: time.Duration(reset) * time.Millisecond,
+		},
+	}
+}
+
+// redis故障时从进程内限流器预定
+func (lim *TokenLimiter) rescueReserveN(now time.Time, n int, maxWait time.Duration) *Reservation {
+	r := lim.getRescueLimiter().ReserveN(now, n)
+	if !r.OK() {
+		return lim.overQuota(xrate.InfDuration)
+	}
+
+	delay := r.DelayFrom(now)
+	if delay > maxWait {
+		r.CancelAt(now)
+		return lim.overQuota(delay)
+	}
+
+	return &Reservation{
+		ok:        true,
+		timeToAct: now.Add(delay),
+		rescue:    r,
+		result: Result{
+			State: Allowed,
+			Limit: lim.burst,
+		},
+	}
+}
+
+// redis故障时使用的进程内限流器
+func (lim *TokenLimiter) getRescueLimiter() *xrate.Limiter {
+	if lim.rescues != nil {
+		return lim.rescues.get(lim.tokenKey)
+	}
+
+	return lim.rescueLimiter
+}
+
+// 预定失败，retryAfter 后可以重试
+func (lim *TokenLimiter) overQuota(retryAfter time.Duration) *Reservation {
+	return &Reservation{
+		result: Result{
+			State:      OverQuota,
+			Limit:      lim.burst,
+			RetryAfter: retryAfter,
+		},
+	}
+}
+
+// 归还n个token
+func (lim *TokenLimiter) cancel(n int) {
+	_, err := lim.store.Eval(
+		cancelScript,
+		[]string{
+			lim.tokenKey,
+		},
+		[]string{
+			strconv.Itoa(lim.burst),
+			strconv.Itoa(n),
+		})
+	if err != nil && err != redis.Nil {
+		logx.Errorf("fail to cancel rate limiter reservation: %s", err)
+	}
+}
+
+// OK returns whether the limiter can provide the requested number of tokens within the maximum wait time.
+// If OK is false, Delay returns InfDuration, and Cancel does nothing.
+// 是否预定成功
+func (r *Reservation) OK() bool {
+	return r.ok
+}
+
+// Delay is shorthand for DelayFrom(time.Now()).
+func (r *Reservation) Delay() time.Duration {
+	return r.DelayFrom(time.Now())
+}
+
+// DelayFrom returns the duration for which the reservation holder must wait
+// before taking the reserved action. Zero duration means act immediately.
+// InfDuration means the limiter cannot grant the tokens requested in this
+// Reservation within the maximum wait time.
+// 距离可以执行还需要等待的时间
+func (r *Reservation) DelayFrom(now time.Time) time.Duration {
+	if !r.ok {
+		return xrate.InfDuration
+	}
+
+	delay := r.timeToAct.Sub(now)
+	if delay < 0 {
+		return 0
+	}
+
+	return delay
+}
+
+// Cancel is shorthand for CancelAt(time.Now()).
+func (r *Reservation) Cancel() {
+	r.CancelAt(time.Now())
+}
+
+// CancelAt indicates that the reservation holder will not perform the reserved action
+// and reverses the effects of this Reservation on the rate limit as much as possible,
+// considering that other reservations may have already been made.
+// It does nothing if the reserved action has been performed at now.
+// 取消预定并归还token，已经到达执行时间的预定无法取消
+func (r *Reservation) CancelAt(now time.Time) {
+	if !r.ok {
+		return
+	}
+
+	if r.rescue != nil {
+		r.rescue.CancelAt(now)
+		return
+	}
+
+	if r.lim == nil || r.tokens == 0 || !r.timeToAct.After(now) {
+		return
+	}
+
+	r.lim.cancel(r.tokens)
+	// 防止重复归还
+	r.tokens = 0
+}
+
+func newRedisMonitor(store *redis.Redis) *redisMonitor {
+	return &redisMonitor{
+		store: store,
+		alive: 1,
+	}
+}
+
+// redis是否健康
+func (m *redisMonitor) isAlive() bool {
+	return atomic.LoadUint32(&m.alive) == 1
 }
 
 // 开启redis健康探测
-func (lim *TokenLimiter) startMonitor() {
-	lim.rescueLock.Lock()
-	defer lim.rescueLock.Unlock()
+func (m *redisMonitor) start() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
 	// 防止重复开启
-	if lim.monitorStarted {
+	if m.started {
 		return
 	}
 	// 设置任务和健康标识
-	lim.monitorStarted = true
-	atomic.StoreUint32(&lim.redisAlive, 0)
+	m.started = true
+	atomic.StoreUint32(&m.alive, 0)
 	// 健康探测
-	go lim.waitForRedis()
+	go m.waitForRedis()
 }
 
 // redis健康探测定时任务
-func (lim *TokenLimiter) waitForRedis() {
+func (m *redisMonitor) waitForRedis() {
 	// 健康探测成功时回调此函数
 	ticker := time.NewTicker(pingInterval)
 	defer func() {
 		ticker.Stop()
-		lim.rescueLock.Lock()
-		lim.monitorStarted = false
-		lim.rescueLock.Unlock()
+		m.lock.Lock()
+		m.started = false
+		m.lock.Unlock()
 	}()
 
 	for range ticker.C {
 		// ping属于redis内置健康探测命令
-		if lim.store.Ping() {
+		if m.store.Ping() {
 			// 健康探测成功，设置健康标识
-			atomic.StoreUint32(&lim.redisAlive, 1)
+			atomic.StoreUint32(&m.alive, 1)
 			return
 		}
 	}
@@ -1,18 +1,18 @@
 package load
 
 import (
+	"context"
 	"errors"
-	"fmt"
-	"log"
 	"math"
 	"sync/atomic"
 	"time"
 
+	"gozerosource/code/core/clock"
 	"gozerosource/code/core/collection"
 	"gozerosource/code/core/stat"
 	"gozerosource/code/core/syncx"
 
-	"github.com/zeromicro/go-zero/core/timex"
+	"github.com/zeromicro/go-zero/core/logx"
 )
 
 const (
@@ -22,8 +22,8 @@ const (
 	defaultCpuThreshold = 900                                     // cpu 过载阀值 （900m 对应 80% 占用率）
 	defaultMinRt        = float64(time.Second / time.Millisecond) // 默认最大的平均响应时间
 	// moving average hyperparameter beta for calculating requests on the fly
-	flyingBeta      = 0.9         // 用于实时计算请求的移动平均超参数β
-	coolOffDuration = time.Second // 冷却时间阀值
+	defaultFlyingBeta = 0.9         // 用于实时计算请求的移动平均超参数β
+	defaultCoolOff    = time.Second // 冷却时间阀值
 )
 
 var (
@@ -34,11 +34,6 @@ var (
 	enabled = syncx.ForAtomicBool(true)
 	// default to be enabled
 	logEnabled = syncx.ForAtomicBool(true)
-	// make it a variable for unit test
-	// cpu 检查函数
-	systemOverloadChecker = func(cpuThreshold int64) bool {
-		return stat.CpuUsage() >= cpuThreshold
-	}
 )
 
 type (
@@ -46,14 +41,22 @@ type (
 	// whether the processing request is successful or not.
 	// 回调函数
 	Promise interface {
-		// Pass lets the caller tell that the call is successful.
+		// Pass lets the caller tell that the call is successful, same as Done(OutcomeSuccess).
 		// 请求成功时回调此函数
 		Pass()
-		// Fail lets the caller tell that the call is failed.
-		// 请求失败时回调此函数
+		// Fail lets the caller tell that the call is timed out or rejected by overloading,
+		// same as Done(OutcomeTimeout).
+		// 请求超时或者过载失败时回调此函数
 		Fail()
+		// Done lets the caller tell the Outcome of the call, the latency is measured since Allow.
+		// 请求结束时回调此函数，耗时从 Allow 开始计算
+		Done(outcome Outcome)
 	}
 
+	// Outcome is the result of a call.
+	// 请求结果
+	Outcome int
+
 	// Shedder is the interface that wraps the Allow method.
 	// 降载接口定义
 	Shedder interface {
@@ -62,8 +65,50 @@ type (
 		// 1. 允许调用，需手动执行 Promise.accept()/reject()上报实际执行任务结构
 		// 2. 拒绝调用，将会直接返回err：服务过载错误 ErrServiceOverloaded
 		Allow() (Promise, error)
+		// AllowCtx is like Allow, but takes the Priority from ctx, the lower classes are dropped first.
+		// 按 context 中的优先级做降载检查，过载时优先丢弃低优先级的请求
+		AllowCtx(ctx context.Context) (Promise, error)
+		// Stats returns a snapshot of the Shedder.
+		// 降载器统计快照
+		Stats() Stats
+		// SetCpuThreshold changes the cpu threshold at runtime.
+		// 运行时调整 cpu 过载阀值
+		SetCpuThreshold(threshold int64)
+	}
+
+	// Stats is a snapshot of a Shedder.
+	// 降载器统计快照
+	Stats struct {
+		CpuUsage  int64   // 当前 cpu 使用率，1000m 表示
+		MaxPass   int64   // 窗口内单个桶的最大请求数
+		MinRt     float64 // 窗口内单个桶的最小平均响应时间，单位毫秒
+		MaxFlight int64   // 系统可承载的最大并发数
+		Flying    int64   // 当前并发数
+		AvgFlying float64 // 滑动平均并发数
+		Drops     int64   // 累计丢弃的请求数
+		Errors    int64   // 窗口内失败的请求数
+		Timeouts  int64   // 窗口内超时的请求数
+		Hot       bool    // 是否有优先级处于冷却期
+		// 被丢弃请求的优先级，仅在 Sink 中有效
+		Priority Priority
+		// 各优先级的统计，按优先级从低到高排列
+		Classes []ClassStats
 	}
 
+	// ClassStats is the statistics of a Priority.
+	// 单个优先级的统计
+	ClassStats struct {
+		Priority Priority // 优先级
+		Total    int64    // 累计请求数
+		Drops    int64    // 累计丢弃的请求数
+		Hot      bool     // 是否处于冷却期
+	}
+
+	// A Sink receives the Stats when a request is dropped.
+	// Sinks are called synchronously, so they should return quickly.
+	// 丢弃请求时的回调，比如输出日志或者上报 Prometheus，同步调用，不应阻塞
+	Sink func(stats Stats)
+
 	// ShedderOption lets caller customize the Shedder.
 	// option参数模式
 	ShedderOption func(opts *shedderOptions)
@@ -76,13 +121,49 @@ type (
 		buckets int
 		// cpu负载临界值
 		cpuThreshold int64
+		// 是否启用降载
+		enabled bool
+		// 是否输出丢弃请求的日志
+		logEnabled bool
+		// 冷却时间
+		coolOff time.Duration
+		// 并发数移动平均的超参数β
+		flyingBeta float64
+		// 时钟，测试时可替换为手动推进的时钟
+		clock clock.Clock
+		// 丢弃请求时的回调
+		sinks []Sink
+		// cpu 之外的过载信号
+		signals []Signal
+		// cpu 使用率，测试时可替换
+		cpuUsage func() int64
+		// 以下为 gradientLimiter 的配置
+		// 初始并发限制
+		initialLimit int
+		// 并发限制的范围
+		minLimit int
+		maxLimit int
+		// 允许的 rtt 增长倍数
+		rttTolerance float64
+		// 采样窗口
+		sampleWindow time.Duration
+		// 是否设置了只适用于 adaptiveShedder 或 gradientLimiter 的配置，用于拒绝错用的配置
+		adaptiveOnly bool
+		gradientOnly bool
 	}
 
 	// 自适应降载结构体，需实现 Shedder 接口
 	adaptiveShedder struct {
 		// cpu负载临界值
 		// 高于临界值代表高负载需要降载保证服务
+		// 原子读写，支持运行时调整
 		cpuThreshold int64
+		// 是否输出丢弃请求的日志
+		logEnabled bool
+		// 冷却时间
+		coolOff time.Duration
+		// 并发数移动平均的超参数β
+		flyingBeta float64
 		// 1s内有多少个桶
 		windows int64
 		// 并发数
@@ -93,37 +174,78 @@ type (
 		// 统计当前正在处理的请求数时必须加锁
 		// 无损并发，提高性能
 		avgFlyingLock syncx.SpinLock
-		// 最后一次拒绝时间
-		dropTime *syncx.AtomicDuration
-		// 最近是否被拒绝过
-		droppedRecently *syncx.AtomicBool
+		// 各优先级的状态，下标为优先级
+		classes [numPriorities]*priorityClass
 		// 请求数统计，通过滑动时间窗口记录最近一段时间内指标
 		passCounter *collection.RollingWindow
 		// 响应时间统计，通过滑动时间窗口记录最近一段时间内指标
 		rtCounter *collection.RollingWindow
+		// 失败请求的响应时间统计，不计入 maxPass 及 minRt，避免快速失败的请求抬高最大并发数
+		errCounter *collection.RollingWindow
+		// 超时请求的响应时间统计
+		timeoutCounter *collection.RollingWindow
+		// 时钟
+		clock clock.Clock
+		// 丢弃请求时的回调
+		sinks []Sink
+		// cpu 之外的过载信号
+		signals []Signal
+		// cpu 使用率，1000m 表示
+		cpuUsage func() int64
 	}
 )
 
-// Disable lets callers disable load shedding.
+const (
+	// OutcomeSuccess means the call is successful, the latency is used to calculate the max flying requests.
+	// 请求成功，耗时用于计算最大并发数
+	OutcomeSuccess Outcome = iota
+	// OutcomeError means the call is failed, like bad requests or internal errors.
+	// 请求失败，比如参数错误、内部错误，快速失败的请求不计入最大并发数的计算
+	OutcomeError
+	// OutcomeTimeout means the call is timed out or rejected by overloading.
+	// 请求超时或者过载
+	OutcomeTimeout
+	// OutcomeIgnored means the call is not processed, like rejected by rate limiting, it's not recorded.
+	// 请求未被处理，比如被限流拒绝，不计入统计
+	OutcomeIgnored
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case OutcomeSuccess:
+		return "success"
+	case OutcomeError:
+		return "error"
+	case OutcomeTimeout:
+		return "timeout"
+	case OutcomeIgnored:
+		return "ignored"
+	default:
+		return "unknown"
+	}
+}
+
+// Disable lets callers disable load shedding of all the Shedders created after,
+// use WithEnabled to disable a single Shedder.
+// 全局关闭降载，单个降载器可以使用 WithEnabled
 func Disable() {
 	enabled.Set(false)
 }
 
-// DisableLog disables the stat logs for load shedding.
+// DisableLog disables the stat logs for load shedding of all the Shedders,
+// use WithLogEnabled to disable the logs of a single Shedder.
+// 全局关闭降载日志，单个降载器可以使用 WithLogEnabled
 func DisableLog() {
 	logEnabled.Set(false)
 }
 
 // 初始化自适应降载器
 // NewAdaptiveShedder returns an adaptive shedder.
-// opts can be used to customize the Shedder.
+// opts can be used to customize the Shedder, it panics on the options of the gradient limiter.
 func NewAdaptiveShedder(opts ...ShedderOption) Shedder {
 	// 为了保证代码统一
 	// 当开发者关闭时返回默认的空实现，实现代码统一
 	// go-zero很多地方都采用了这种设计，比如Breaker，日志组件
-	if !enabled.True() {
-		return newNopShedder()
-	}
 	// options模式设置可选配置参数
 	options := shedderOptions{
 		// 默认统计最近5s内数据
@@ -132,41 +254,83 @@ func NewAdaptiveShedder(opts ...ShedderOption) Shedder {
 		buckets: defaultBuckets,
 		// cpu负载
 		cpuThreshold: defaultCpuThreshold,
+		enabled:      true,
+		logEnabled:   true,
+		coolOff:      defaultCoolOff,
+		flyingBeta:   defaultFlyingBeta,
+		clock:        clock.Real,
+		cpuUsage:     stat.CpuUsage,
 	}
 	for _, opt := range opts {
 		opt(&options)
 	}
+	if options.gradientOnly {
+		panic("load: WithInitialLimit, WithLimits, WithRttTolerance and WithSampleWindow " +
+			"only apply to NewGradientLimiter")
+	}
+	if !enabled.True() || !options.enabled {
+		return newNopShedder()
+	}
 	// 计算每个窗口间隔时间，默认为100ms
 	bucketDuration := options.window / time.Duration(options.buckets)
-	return &adaptiveShedder{
+	as := &adaptiveShedder{
 		// cpu负载
 		cpuThreshold: options.cpuThreshold,
+		logEnabled:   options.logEnabled,
+		coolOff:      options.coolOff,
+		flyingBeta:   options.flyingBeta,
 		// 1s的时间内包含多少个滑动窗口单元
 		windows: int64(time.Second / bucketDuration),
-		// 最近一次拒绝时间
-		dropTime: syncx.NewAtomicDuration(),
-		// 最近是否被拒绝过
-		droppedRecently: syncx.NewAtomicBool(),
 		// qps统计，滑动时间窗口
 		// 忽略当前正在写入窗口（桶），时间周期不完整可能导致数据异常
 		passCounter: collection.NewRollingWindow(options.buckets, bucketDuration,
-			collection.IgnoreCurrentBucket()),
+			collection.IgnoreCurrentBucket(), collection.WithClock(options.clock)),
 		// 响应时间统计，滑动时间窗口
 		// 忽略当前正在写入窗口（桶），时间周期不完整可能导致数据异常
 		rtCounter: collection.NewRollingWindow(options.buckets, bucketDuration,
-			collection.IgnoreCurrentBucket()),
+			collection.IgnoreCurrentBucket(), collection.WithClock(options.clock)),
+		errCounter: collection.NewRollingWindow(options.buckets, bucketDuration,
+			collection.WithClock(options.clock)),
+		timeoutCounter: collection.NewRollingWindow(options.buckets, bucketDuration,
+			collection.WithClock(options.clock)),
+		clock:    options.clock,
+		sinks:    options.sinks,
+		signals:  options.signals,
+		cpuUsage: options.cpuUsage,
+	}
+	for i := range as.classes {
+		as.classes[i] = &priorityClass{
+			// 最近一次拒绝时间
+			dropTime: syncx.NewAtomicDuration(),
+			// 最近是否被拒绝过
+			droppedRecently: syncx.NewAtomicBool(),
+		}
 	}
+
+	return as
 }
 
 // Allow implements Shedder.Allow.
 // 降载检查
 func (as *adaptiveShedder) Allow() (Promise, error) {
+	return as.allow(PriorityDefault)
+}
+
+// AllowCtx implements Shedder.AllowCtx.
+// 按 context 中的优先级做降载检查
+func (as *adaptiveShedder) AllowCtx(ctx context.Context) (Promise, error) {
+	return as.allow(PriorityFromContext(ctx))
+}
+
+func (as *adaptiveShedder) allow(p Priority) (Promise, error) {
+	class := as.classes[p]
+	atomic.AddInt64(&class.total, 1)
 	// 检查请求是否被丢弃
-	if as.shouldDrop() {
+	if as.shouldDrop(p) {
 		// 设置drop时间
-		as.dropTime.Set(timex.Now())
+		class.dropTime.Set(as.clock.Now())
 		// 最近已被drop
-		as.droppedRecently.Set(true)
+		class.droppedRecently.Set(true)
 		// 返回过载
 		return nil, ErrServiceOverloaded
 	}
@@ -175,7 +339,7 @@ func (as *adaptiveShedder) Allow() (Promise, error) {
 	// 这里每个允许的请求都会返回一个新的promise对象
 	// promise内部持有了降载指针对象
 	return &promise{
-		start:   timex.Now(),
+		start:   as.clock.Now(),
 		shedder: as,
 	}, nil
 }
@@ -191,13 +355,13 @@ func (as *adaptiveShedder) addFlying(delta int64) {
 	if delta < 0 {
 		as.avgFlyingLock.Lock()
 		// 估算当前服务近一段时间内的平均请求数
-		as.avgFlying = as.avgFlying*flyingBeta + float64(flying)*(1-flyingBeta)
+		as.avgFlying = as.avgFlying*as.flyingBeta + float64(flying)*(1-as.flyingBeta)
 		as.avgFlyingLock.Unlock()
 	}
 }
 
-// 检查当前正在处理的并发数
-func (as *adaptiveShedder) highThru() bool {
+// 检查当前正在处理的并发数，返回计算过程中的并发统计，丢弃请求时用于输出日志
+func (as *adaptiveShedder) highThru() (flightStat, bool) {
 	// 加锁
 	as.avgFlyingLock.Lock()
 	// 获取滑动平均值
@@ -205,25 +369,33 @@ func (as *adaptiveShedder) highThru() bool {
 	avgFlying := as.avgFlying
 	// 解锁
 	as.avgFlyingLock.Unlock()
+	fs := flightStat{
+		maxPass:   as.maxPass(),
+		minRt:     as.minRt(),
+		flying:    atomic.LoadInt64(&as.flying),
+		avgFlying: avgFlying,
+	}
 	// 系统此时最大并发数
-	maxFlight := as.maxFlight()
-	fmt.Println("avgFlying", avgFlying)
-	fmt.Println("maxFlight", maxFlight)
-	fmt.Println("as.flying", as.flying)
+	maxFlight := as.flightOf(fs.maxPass, fs.minRt)
 	// 正在处理的并发数和平均并发数是否大于系统的最大并发数
-	return int64(avgFlying) > maxFlight && atomic.LoadInt64(&as.flying) > maxFlight
+	return fs, int64(avgFlying) > maxFlight && fs.flying > maxFlight
 }
 
 // 计算每秒系统的最大并发数
 // 最大并发数 = 最大请求数（qps）* 最小响应时间（rt）
 func (as *adaptiveShedder) maxFlight() int64 {
+	return as.flightOf(as.maxPass(), as.minRt())
+}
+
+// 由最大请求数及最小响应时间计算最大并发数
+func (as *adaptiveShedder) flightOf(maxPass int64, minRt float64) int64 {
 	// windows = buckets per second
 	// maxQPS = maxPASS * windows
 	// minRT = min average response time in milliseconds
 	// maxQPS * minRT / milliseconds_per_second
 	// as.maxPass()*as.windows - 每个桶最大的qps * 1s内包含桶的数量
 	// as.minRt()/1e3 - 窗口所有桶中最小的平均响应时间 / 1000ms这里是为了转换成秒
-	return int64(math.Max(1, float64(as.maxPass()*as.windows)*(as.minRt()/1e3)))
+	return int64(math.Max(1, float64(maxPass*as.windows)*(minRt/1e3)))
 }
 
 // 滑动时间窗口内有多个桶
@@ -264,22 +436,16 @@ func (as *adaptiveShedder) minRt() float64 {
 }
 
 // 请求是否应该被丢弃
-func (as *adaptiveShedder) shouldDrop() bool {
+// 低优先级的 cpu 阀值更低，过载时最先被丢弃，各优先级分别计算冷却期
+func (as *adaptiveShedder) shouldDrop(p Priority) bool {
 	// 当前cpu负载超过阈值
 	// 服务处于冷却期内应该继续检查负载并尝试丢弃请求
-	if as.systemOverloaded() || as.stillHot() {
+	if as.systemOverloaded(p) || as.stillHot(p) {
 		// 检查正在处理的并发是否超出当前可承载的最大并发数
 		// 超出则丢弃请求
-		if as.highThru() {
-			flying := atomic.LoadInt64(&as.flying)
-			as.avgFlyingLock.Lock()
-			avgFlying := as.avgFlying
-			as.avgFlyingLock.Unlock()
-			msg := fmt.Sprintf(
-				"dropreq, cpu: %d, maxPass: %d, minRt: %.2f, hot: %t, flying: %d, avgFlying: %.2f",
-				stat.CpuUsage(), as.maxPass(), as.minRt(), as.stillHot(), flying, avgFlying)
-			log.Println(msg)
-			// stat.Report(msg)
+		if fs, high := as.highThru(); high {
+			atomic.AddInt64(&as.classes[p].drops, 1)
+			as.report(p, fs)
 			return true
 		}
 	}
@@ -287,55 +453,280 @@ func (as *adaptiveShedder) shouldDrop() bool {
 	return false
 }
 
-// 检查是否处于冷却期
-func (as *adaptiveShedder) stillHot() bool {
+// Stats implements Shedder.Stats.
+// 降载器统计快照
+func (as *adaptiveShedder) Stats() Stats {
+	as.avgFlyingLock.Lock()
+	avgFlying := as.avgFlying
+	as.avgFlyingLock.Unlock()
+
+	stats := Stats{
+		CpuUsage:  as.cpuUsage(),
+		MaxPass:   as.maxPass(),
+		MinRt:     as.minRt(),
+		MaxFlight: as.maxFlight(),
+		Flying:    atomic.LoadInt64(&as.flying),
+		AvgFlying: avgFlying,
+		Errors:    countOf(as.errCounter),
+		Timeouts:  countOf(as.timeoutCounter),
+		Priority:  PriorityDefault,
+		Classes:   make([]ClassStats, 0, numPriorities),
+	}
+	for i, class := range as.classes {
+		p := Priority(i)
+		cs := ClassStats{
+			Priority: p,
+			Total:    atomic.LoadInt64(&class.total),
+			Drops:    atomic.LoadInt64(&class.drops),
+			Hot:      as.stillHot(p),
+		}
+		stats.Drops += cs.Drops
+		stats.Hot = stats.Hot || cs.Hot
+		stats.Classes = append(stats.Classes, cs)
+	}
+
+	return stats
+}
+
+// 丢弃请求时输出统计信息，日志直接使用过载判断时的并发统计
+// 只有注册了回调时才生成完整的统计快照，避免过载时额外的开销
+func (as *adaptiveShedder) report(p Priority, fs flightStat) {
+	if logEnabled.True() && as.logEnabled {
+		logx.Errorf("dropreq, priority: %s, cpu: %d, maxPass: %d, minRt: %.2f, hot: %t, flying: %d, avgFlying: %.2f",
+			p, as.cpuUsage(), fs.maxPass, fs.minRt, as.stillHot(p), fs.flying, fs.avgFlying)
+	}
+	if len(as.sinks) == 0 {
+		return
+	}
+
+	stats := as.Stats()
+	stats.Priority = p
+	for _, sink := range as.sinks {
+		sink(stats)
+	}
+}
+
+// SetCpuThreshold implements Shedder.SetCpuThreshold, negative thresholds are ignored.
+// 运行时调整 cpu 过载阀值，忽略负数
+func (as *adaptiveShedder) SetCpuThreshold(threshold int64) {
+	if threshold < 0 {
+		logx.Errorf("invalid cpu threshold: %d, ignored", threshold)
+		return
+	}
+
+	atomic.StoreInt64(&as.cpuThreshold, threshold)
+}
+
+// 检查优先级是否处于冷却期
+func (as *adaptiveShedder) stillHot(p Priority) bool {
+	class := as.classes[p]
 	// 最近没有丢弃请求
 	// 说明服务正常
-	if !as.droppedRecently.True() {
+	if !class.droppedRecently.True() {
 		return false
 	}
 	// 不在冷却期
-	dropTime := as.dropTime.Load()
+	dropTime := class.dropTime.Load()
 	if dropTime == 0 {
 		return false
 	}
 	// 冷却时间默认为1s
-	hot := timex.Since(dropTime) < coolOffDuration
+	hot := as.clock.Since(dropTime) < as.coolOff
 	if !hot {
 		// 重置drop记录
-		as.droppedRecently.Set(false)
+		class.droppedRecently.Set(false)
 	}
 
 	return hot
 }
 
-// cpu 是否过载
-func (as *adaptiveShedder) systemOverloaded() bool {
-	return systemOverloadChecker(as.cpuThreshold)
+// cpu 超过优先级对应的阀值，或者任意一个过载信号过载
+func (as *adaptiveShedder) systemOverloaded(p Priority) bool {
+	if as.cpuUsage() >= p.cpuThreshold(atomic.LoadInt64(&as.cpuThreshold)) {
+		return true
+	}
+
+	for _, signal := range as.signals {
+		if signal.Pressure() >= 1 {
+			return true
+		}
+	}
+
+	return false
 }
 
-// WithBuckets customizes the Shedder with given number of buckets.
+// WithBuckets customizes the adaptive shedder with given number of buckets.
 func WithBuckets(buckets int) ShedderOption {
 	return func(opts *shedderOptions) {
+		opts.adaptiveOnly = true
 		opts.buckets = buckets
 	}
 }
 
-// WithCpuThreshold customizes the Shedder with given cpu threshold.
-// 设置 cpu 过载阀值
+// WithCpuThreshold customizes the adaptive shedder with given cpu threshold, negative thresholds are ignored.
+// 设置 cpu 过载阀值，忽略负数
 func WithCpuThreshold(threshold int64) ShedderOption {
 	return func(opts *shedderOptions) {
-		opts.cpuThreshold = threshold
+		opts.adaptiveOnly = true
+		if threshold >= 0 {
+			opts.cpuThreshold = threshold
+		}
+	}
+}
+
+// WithCpuUsage customizes the adaptive shedder with given cpu usage source using 1000m notation,
+// mostly used in tests, nil is ignored.
+// 设置 cpu 使用率的来源，1000m 表示，主要用于测试，忽略 nil
+func WithCpuUsage(usage func() int64) ShedderOption {
+	return func(opts *shedderOptions) {
+		opts.adaptiveOnly = true
+		if usage != nil {
+			opts.cpuUsage = usage
+		}
+	}
+}
+
+// WithClock customizes the Shedder with given Clock, mostly used in tests.
+// 设置时钟，用于测试
+func WithClock(c clock.Clock) ShedderOption {
+	return func(opts *shedderOptions) {
+		opts.clock = c
+	}
+}
+
+// WithCoolOff customizes the adaptive shedder with given cool-off duration,
+// the Shedder keeps checking the flying requests for the duration after a request is dropped.
+// 设置冷却时间，丢弃请求后的这段时间内即使 cpu 未过载也会继续检查并发数
+func WithCoolOff(coolOff time.Duration) ShedderOption {
+	return func(opts *shedderOptions) {
+		opts.adaptiveOnly = true
+		opts.coolOff = coolOff
+	}
+}
+
+// WithEnabled customizes the Shedder to be enabled or not, a disabled Shedder allows all requests.
+// 设置是否启用降载，关闭后允许所有请求
+func WithEnabled(enabled bool) ShedderOption {
+	return func(opts *shedderOptions) {
+		opts.enabled = enabled
+	}
+}
+
+// WithFlyingBeta customizes the adaptive shedder with given beta in (0, 1) to calculate the moving average
+// of flying requests, the bigger beta is, the smoother and more lagging avgFlying is.
+// 设置并发数移动平均的超参数β，取值 (0, 1)，越大越平滑，滞后也越明显
+func WithFlyingBeta(beta float64) ShedderOption {
+	return func(opts *shedderOptions) {
+		opts.adaptiveOnly = true
+		opts.flyingBeta = beta
 	}
 }
 
-// WithWindow customizes the Shedder with given
+// WithInitialLimit customizes the gradient limiter with given initial concurrency limit,
+// non-positive limits are ignored, the limit is clamped into the range of WithLimits.
+// 设置 gradientLimiter 的初始并发限制，忽略小于等于 0 的值，超出并发限制范围时取边界值
+func WithInitialLimit(limit int) ShedderOption {
+	return func(opts *shedderOptions) {
+		opts.gradientOnly = true
+		if limit > 0 {
+			opts.initialLimit = limit
+		}
+	}
+}
+
+// WithLimits customizes the gradient limiter with given range of concurrency limit,
+// it's ignored if min is not positive or max is less than min.
+// 设置 gradientLimiter 的并发限制范围，min 小于等于 0 或者 max 小于 min 时忽略
+func WithLimits(min, max int) ShedderOption {
+	return func(opts *shedderOptions) {
+		opts.gradientOnly = true
+		if min > 0 && max >= min {
+			opts.minLimit = min
+			opts.maxLimit = max
+		}
+	}
+}
+
+// WithLogEnabled customizes the Shedder to log the dropped requests or not.
+// 设置是否输出丢弃请求的日志
+func WithLogEnabled(enabled bool) ShedderOption {
+	return func(opts *shedderOptions) {
+		opts.logEnabled = enabled
+	}
+}
+
+// WithRttTolerance customizes the gradient limiter with given tolerance of rtt growth,
+// the limit is not reduced if the sampled rtt is less than long rtt * tolerance, tolerances less than 1 are ignored.
+// 设置 gradientLimiter 允许的 rtt 增长倍数，忽略小于 1 的值
+func WithRttTolerance(tolerance float64) ShedderOption {
+	return func(opts *shedderOptions) {
+		opts.gradientOnly = true
+		if tolerance >= 1 {
+			opts.rttTolerance = tolerance
+		}
+	}
+}
+
+// WithSampleWindow customizes the gradient limiter with given sample window,
+// the limit is updated once per window, non-positive windows are ignored.
+// 设置 gradientLimiter 的采样窗口，每个窗口更新一次并发限制，忽略小于等于 0 的值
+func WithSampleWindow(window time.Duration) ShedderOption {
+	return func(opts *shedderOptions) {
+		opts.gradientOnly = true
+		if window > 0 {
+			opts.sampleWindow = window
+		}
+	}
+}
+
+// WithSignals customizes the Shedder with given Signals besides cpu,
+// the system is overloaded if cpu or any of the Signals is overloaded.
+// Use WeightedSignal to combine Signals if needed.
+// 设置 cpu 之外的过载信号，cpu 或者任意一个信号过载即认为系统过载
+// 需要综合判断时可以使用 WeightedSignal 组合多个信号
+func WithSignals(signals ...Signal) ShedderOption {
+	return func(opts *shedderOptions) {
+		opts.adaptiveOnly = true
+		opts.signals = append(opts.signals, signals...)
+	}
+}
+
+// WithSink customizes the Shedder with given Sink, which is called when a request is dropped.
+// 设置丢弃请求时的回调
+func WithSink(sink Sink) ShedderOption {
+	return func(opts *shedderOptions) {
+		opts.sinks = append(opts.sinks, sink)
+	}
+}
+
+// WithWindow customizes the adaptive shedder with given window.
 func WithWindow(window time.Duration) ShedderOption {
 	return func(opts *shedderOptions) {
+		opts.adaptiveOnly = true
 		opts.window = window
 	}
 }
 
+// 过载判断时的并发统计
+type flightStat struct {
+	maxPass   int64
+	minRt     float64
+	flying    int64
+	avgFlying float64
+}
+
+// 单个优先级的状态
+type priorityClass struct {
+	// 最后一次拒绝时间
+	dropTime *syncx.AtomicDuration
+	// 最近是否被拒绝过
+	droppedRecently *syncx.AtomicBool
+	// 累计请求数
+	total int64
+	// 累计丢弃的请求数
+	drops int64
+}
+
 type promise struct {
 	// 请求开始时间
 	start time.Duration
@@ -344,15 +735,35 @@ type promise struct {
 }
 
 func (p *promise) Fail() {
-	// 请求结束，当前正在处理请求数-1
-	p.shedder.addFlying(-1)
+	p.Done(OutcomeTimeout)
 }
 
 func (p *promise) Pass() {
+	p.Done(OutcomeSuccess)
+}
+
+func (p *promise) Done(outcome Outcome) {
 	// 响应时间，单位毫秒
-	rt := float64(timex.Since(p.start)) / float64(time.Millisecond)
+	rt := math.Ceil(float64(p.shedder.clock.Since(p.start)) / float64(time.Millisecond))
 	// 请求结束，当前正在处理请求数-1
 	p.shedder.addFlying(-1)
-	p.shedder.rtCounter.Add(math.Ceil(rt))
-	p.shedder.passCounter.Add(1)
+	switch outcome {
+	case OutcomeSuccess:
+		p.shedder.rtCounter.Add(rt)
+		p.shedder.passCounter.Add(1)
+	case OutcomeError:
+		p.shedder.errCounter.Add(rt)
+	case OutcomeTimeout:
+		p.shedder.timeoutCounter.Add(rt)
+	}
+}
+
+// 窗口内的请求数
+func countOf(rw *collection.RollingWindow) int64 {
+	var count int64
+	rw.Reduce(func(b *collection.Bucket) {
+		count += b.Count
+	})
+
+	return count
 }
@@ -0,0 +1,285 @@
+package load
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gozerosource/code/core/clock"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+const (
+	defaultInitialLimit = 20
+	defaultMinLimit     = 1
+	defaultMaxLimit     = 1000
+	// 允许的 rtt 增长倍数，sampled rtt 小于 long rtt * tolerance 时不会降低并发限制
+	defaultRttTolerance = 1.5
+	// 采样窗口，每个窗口更新一次并发限制
+	defaultSampleWindow = time.Second
+	// 并发限制的平滑系数
+	limitSmoothing = 0.2
+	// long rtt 的移动平均系数，约等于最近 600 个窗口的平均值
+	longRttBeta = 1 - 2.0/(600+1)
+	// 失败（超时）后并发限制的衰减比例
+	backoffRatio = 0.9
+)
+
+// 各优先级可使用的并发限制比例，低优先级先被拒绝
+var priorityLimitRatios = [numPriorities]float64{
+	PrioritySheddable: 0.75,
+	PriorityDefault:   1,
+	PriorityCritical:  1.25,
+}
+
+type (
+	// 基于 rtt 梯度的自适应并发限制器，参考 Netflix concurrency-limits 的 gradient2 算法
+	// gradient = long rtt * tolerance / sampled rtt，取值 [0.5, 1]
+	// newLimit = limit * gradient + sqrt(limit)
+	// rtt 变长说明出现排队，并发限制随之降低；rtt 稳定时并发限制按 sqrt(limit) 增长
+	gradientLimiter struct {
+		lock sync.Mutex
+		// 当前并发限制
+		limit    float64
+		minLimit float64
+		maxLimit float64
+		// 正在处理的请求数
+		flying int64
+		// rtt 长期平均值，单位毫秒，作为无排队时的 rtt 基线
+		longRtt float64
+		// 当前采样窗口的 rtt 之和及请求数
+		sampleRtt   float64
+		sampleCount int64
+		// 当前采样窗口是否有失败的请求
+		sampleDrop bool
+		// 当前采样窗口的开始时间
+		sampleStart  time.Duration
+		sampleWindow time.Duration
+		tolerance    float64
+		classes      [numPriorities]*priorityClass
+		logEnabled   bool
+		clock        clock.Clock
+		sinks        []Sink
+	}
+
+	gradientPromise struct {
+		start   time.Duration
+		limiter *gradientLimiter
+	}
+)
+
+// NewGradientLimiter returns a Shedder that limits the concurrency adaptively by the latency,
+// it's for the services that cpu is not the bottleneck.
+// WithEnabled, WithLogEnabled, WithClock, WithSink, WithInitialLimit, WithLimits,
+// WithRttTolerance and WithSampleWindow can be used to customize it,
+// it panics on the other options that only apply to the adaptive shedder.
+// 基于延迟的自适应并发限制器，适用于 cpu 不是瓶颈的服务，使用只适用于 adaptiveShedder 的配置时 panic
+func NewGradientLimiter(opts ...ShedderOption) Shedder {
+	options := shedderOptions{
+		enabled:      true,
+		logEnabled:   true,
+		clock:        clock.Real,
+		initialLimit: defaultInitialLimit,
+		minLimit:     defaultMinLimit,
+		maxLimit:     defaultMaxLimit,
+		rttTolerance: defaultRttTolerance,
+		sampleWindow: defaultSampleWindow,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.adaptiveOnly {
+		panic("load: WithWindow, WithBuckets, WithCpuThreshold, WithCpuUsage, WithCoolOff, WithFlyingBeta " +
+			"and WithSignals only apply to NewAdaptiveShedder")
+	}
+	if !enabled.True() || !options.enabled {
+		return newNopShedder()
+	}
+	// 初始并发限制不能超出并发限制范围
+	initialLimit := options.initialLimit
+	if initialLimit < options.minLimit {
+		initialLimit = options.minLimit
+	} else if initialLimit > options.maxLimit {
+		initialLimit = options.maxLimit
+	}
+
+	gl := &gradientLimiter{
+		limit:        float64(initialLimit),
+		minLimit:     float64(options.minLimit),
+		maxLimit:     float64(options.maxLimit),
+		sampleStart:  options.clock.Now(),
+		sampleWindow: options.sampleWindow,
+		tolerance:    options.rttTolerance,
+		logEnabled:   options.logEnabled,
+		clock:        options.clock,
+		sinks:        options.sinks,
+	}
+	for i := range gl.classes {
+		gl.classes[i] = new(priorityClass)
+	}
+
+	return gl
+}
+
+// Allow implements Shedder.Allow.
+func (gl *gradientLimiter) Allow() (Promise, error) {
+	return gl.allow(PriorityDefault)
+}
+
+// AllowCtx implements Shedder.AllowCtx.
+func (gl *gradientLimiter) AllowCtx(ctx context.Context) (Promise, error) {
+	return gl.allow(PriorityFromContext(ctx))
+}
+
+// SetCpuThreshold implements Shedder.SetCpuThreshold, it does nothing because cpu is not used.
+// 不依赖 cpu，无需处理
+func (gl *gradientLimiter) SetCpuThreshold(threshold int64) {
+}
+
+// Stats implements Shedder.Stats, MaxFlight is the current limit, MinRt is the long rtt,
+// CpuUsage is always 0 because cpu is not used.
+// 统计快照，MaxFlight 为当前并发限制，MinRt 为 rtt 基线，不依赖 cpu，CpuUsage 为 0
+func (gl *gradientLimiter) Stats() Stats {
+	gl.lock.Lock()
+	stats := Stats{
+		MinRt:     gl.longRtt,
+		MaxFlight: int64(gl.limit),
+		Flying:    gl.flying,
+		AvgFlying: float64(gl.flying),
+		Priority:  PriorityDefault,
+		Classes:   make([]ClassStats, 0, numPriorities),
+	}
+	gl.lock.Unlock()
+
+	for i, class := range gl.classes {
+		cs := ClassStats{
+			Priority: Priority(i),
+			Total:    atomic.LoadInt64(&class.total),
+			Drops:    atomic.LoadInt64(&class.drops),
+		}
+		stats.Drops += cs.Drops
+		stats.Classes = append(stats.Classes, cs)
+	}
+
+	return stats
+}
+
+func (gl *gradientLimiter) allow(p Priority) (Promise, error) {
+	class := gl.classes[p]
+	atomic.AddInt64(&class.total, 1)
+
+	gl.lock.Lock()
+	if float64(gl.flying) >= gl.limit*priorityLimitRatios[p] {
+		gl.lock.Unlock()
+		atomic.AddInt64(&class.drops, 1)
+		gl.report(p)
+		return nil, ErrServiceOverloaded
+	}
+	gl.flying++
+	gl.lock.Unlock()
+
+	return &gradientPromise{
+		start:   gl.clock.Now(),
+		limiter: gl,
+	}, nil
+}
+
+// 请求结束，只有成功的请求计入 rtt，超时的请求会降低并发限制
+func (gl *gradientLimiter) done(rtt float64, outcome Outcome) {
+	gl.lock.Lock()
+	defer gl.lock.Unlock()
+
+	flying := gl.flying
+	gl.flying--
+	switch outcome {
+	case OutcomeSuccess:
+		gl.sampleRtt += rtt
+		gl.sampleCount++
+	case OutcomeTimeout:
+		gl.sampleDrop = true
+	}
+
+	now := gl.clock.Now()
+	if now-gl.sampleStart < gl.sampleWindow {
+		return
+	}
+
+	gl.updateLimitLocked(flying)
+	gl.sampleStart = now
+	gl.sampleRtt = 0
+	gl.sampleCount = 0
+	gl.sampleDrop = false
+}
+
+// 每个采样窗口结束时更新并发限制
+func (gl *gradientLimiter) updateLimitLocked(flying int64) {
+	// 出现失败时按比例降低并发限制
+	if gl.sampleDrop {
+		gl.limit = math.Max(gl.minLimit, gl.limit*backoffRatio)
+		return
+	}
+	if gl.sampleCount == 0 {
+		return
+	}
+
+	shortRtt := gl.sampleRtt / float64(gl.sampleCount)
+	// rtt 为 0 时无法计算梯度，跳过这个窗口，比如时钟精度不足
+	if shortRtt <= 0 {
+		return
+	}
+	if gl.longRtt == 0 {
+		gl.longRtt = shortRtt
+	} else {
+		gl.longRtt = gl.longRtt*longRttBeta + shortRtt*(1-longRttBeta)
+	}
+	// rtt 基线远大于当前 rtt 时，说明基线已经过时，快速衰减
+	if gl.longRtt/shortRtt > 2 {
+		gl.longRtt *= 0.95
+	}
+
+	gradient := math.Max(0.5, math.Min(1, gl.tolerance*gl.longRtt/shortRtt))
+	newLimit := gl.limit*gradient + math.Sqrt(gl.limit)
+	newLimit = gl.limit*(1-limitSmoothing) + newLimit*limitSmoothing
+	// 并发数远小于限制时，无法判断是否还能承载更多请求，不增加限制
+	if float64(flying) < gl.limit/2 && newLimit > gl.limit {
+		return
+	}
+	gl.limit = math.Max(gl.minLimit, math.Min(gl.maxLimit, newLimit))
+}
+
+// 拒绝请求时输出统计信息
+func (gl *gradientLimiter) report(p Priority) {
+	if logEnabled.True() && gl.logEnabled {
+		gl.lock.Lock()
+		limit, flying, longRtt := int64(gl.limit), gl.flying, gl.longRtt
+		gl.lock.Unlock()
+		logx.Errorf("dropreq, priority: %s, limit: %d, flying: %d, longRtt: %.2f",
+			p, limit, flying, longRtt)
+	}
+	// 只有注册了回调时才生成完整的统计快照
+	if len(gl.sinks) == 0 {
+		return
+	}
+
+	stats := gl.Stats()
+	stats.Priority = p
+	for _, sink := range gl.sinks {
+		sink(stats)
+	}
+}
+
+func (p *gradientPromise) Fail() {
+	p.Done(OutcomeTimeout)
+}
+
+func (p *gradientPromise) Pass() {
+	p.Done(OutcomeSuccess)
+}
+
+func (p *gradientPromise) Done(outcome Outcome) {
+	rt := float64(p.limiter.clock.Since(p.start)) / float64(time.Millisecond)
+	p.limiter.done(rt, outcome)
+}
@@ -1,5 +1,7 @@
 package load
 
+import "context"
+
 type nopShedder struct{}
 
 func newNopShedder() Shedder {
@@ -10,6 +12,17 @@ func (s nopShedder) Allow() (Promise, error) {
 	return nopPromise{}, nil
 }
 
+func (s nopShedder) AllowCtx(ctx context.Context) (Promise, error) {
+	return nopPromise{}, nil
+}
+
+func (s nopShedder) Stats() Stats {
+	return Stats{}
+}
+
+func (s nopShedder) SetCpuThreshold(threshold int64) {
+}
+
 type nopPromise struct{}
 
 func (p nopPromise) Pass() {
@@ -17,3 +30,6 @@ func (p nopPromise) Pass() {
 
 func (p nopPromise) Fail() {
 }
+
+func (p nopPromise) Done(outcome Outcome) {
+}
@@ -0,0 +1,115 @@
+package load
+
+import (
+	"context"
+	"strings"
+)
+
+const (
+	// PriorityKey is the key of the Priority in grpc metadata.
+	// grpc metadata 中优先级的 key
+	PriorityKey = "x-load-priority"
+
+	// use 1000m to represent 100%
+	topCpuUsage = 1000
+)
+
+// Priority is the class of a request, the requests of lower classes are dropped first.
+// 请求优先级，过载时优先丢弃低优先级的请求
+type Priority int
+
+const (
+	// PrioritySheddable is for the requests that can be dropped first, like prefetching.
+	// 可丢弃：最先被丢弃，比如预加载
+	PrioritySheddable Priority = iota
+	// PriorityDefault is for the normal requests.
+	// 默认优先级
+	PriorityDefault
+	// PriorityCritical is for the requests that should be dropped last, like payments.
+	// 关键：最后被丢弃，比如支付
+	PriorityCritical
+
+	numPriorities = int(PriorityCritical) + 1
+)
+
+// 优先级的 context key
+type priorityKey struct{}
+
+func (p Priority) String() string {
+	switch p {
+	case PrioritySheddable:
+		return "sheddable"
+	case PriorityDefault:
+		return "default"
+	case PriorityCritical:
+		return "critical"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (p Priority) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// ParsePriority parses the Priority from its name, case insensitive.
+// 根据名称解析优先级，比如从 grpc metadata 中读取
+func ParsePriority(name string) (Priority, bool) {
+	switch strings.ToLower(name) {
+	case "sheddable":
+		return PrioritySheddable, true
+	case "default":
+		return PriorityDefault, true
+	case "critical":
+		return PriorityCritical, true
+	default:
+		return PriorityDefault, false
+	}
+}
+
+// NewPriorityContext returns a new context that carries the Priority.
+// 将优先级保存到 context 中
+func NewPriorityContext(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityFromContext returns the Priority in ctx, PriorityDefault if not set.
+// 从 context 中获取优先级，未设置时为 PriorityDefault
+func PriorityFromContext(ctx context.Context) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return p.normalize()
+	}
+
+	return PriorityDefault
+}
+
+// 超出范围的优先级归到最近的优先级
+func (p Priority) normalize() Priority {
+	if p < PrioritySheddable {
+		return PrioritySheddable
+	}
+	if p > PriorityCritical {
+		return PriorityCritical
+	}
+
+	return p
+}
+
+// cpu 过载阀值，每高一个优先级，阀值向 100% 靠近一半
+// 比如阀值为 900m 时，sheddable 为 800m，default 为 900m，critical 为 950m
+// 阀值较低时 sheddable 至少为阀值的一半，比如阀值为 500m 时为 250m，避免始终处于过载状态
+func (p Priority) cpuThreshold(threshold int64) int64 {
+	switch p.normalize() {
+	case PrioritySheddable:
+		sheddable := threshold - (topCpuUsage - threshold)
+		if floor := threshold >> 1; sheddable < floor {
+			sheddable = floor
+		}
+		return sheddable
+	case PriorityCritical:
+		return (threshold + topCpuUsage) >> 1
+	default:
+		return threshold
+	}
+}
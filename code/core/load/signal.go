@@ -0,0 +1,138 @@
+package load
+
+import (
+	"fmt"
+	"runtime"
+
+	"gozerosource/code/core/stat"
+)
+
+type (
+	// A Signal reports the pressure of a resource, 1 or above means overloaded.
+	// 过载信号，返回资源压力，大于等于 1 表示过载
+	Signal interface {
+		Pressure() float64
+	}
+
+	// SignalFunc is an adapter to allow the use of ordinary functions as Signals.
+	// 函数形式的过载信号，可用于自定义探测
+	SignalFunc func() float64
+
+	// Weighted is a Signal with weight, used to combine Signals.
+	// 带权重的过载信号
+	Weighted struct {
+		Signal Signal
+		Weight float64
+	}
+
+	// 按权重组合的过载信号
+	weightedSignal []Weighted
+)
+
+// Pressure implements Signal.Pressure.
+func (f SignalFunc) Pressure() float64 {
+	return f()
+}
+
+// CpuSignal returns a Signal that is overloaded when the cpu usage reaches threshold, using 1000m notation.
+// The threshold signals panic if threshold is not positive.
+// cpu 使用率过载信号，阀值使用 1000m 表示，各阀值信号在阀值小于等于 0 时 panic
+func CpuSignal(threshold int64) Signal {
+	return ratioSignal(stat.CpuUsage, threshold)
+}
+
+// MemorySignal returns a Signal that is overloaded when the memory usage against the cgroup limit
+// reaches threshold, using 1000m notation. It's never overloaded if the memory is not limited.
+// cgroup 内存使用率过载信号，阀值使用 1000m 表示，未限制内存时不会过载
+func MemorySignal(threshold int64) Signal {
+	return ratioSignal(stat.MemoryUsage, threshold)
+}
+
+// GcPauseSignal returns a Signal that is overloaded when the ratio of time spent in gc pauses
+// reaches threshold, using 1000m notation.
+// gc 暂停时间占比过载信号，阀值使用 1000m 表示
+func GcPauseSignal(threshold int64) Signal {
+	return ratioSignal(stat.GcPause, threshold)
+}
+
+// CpuPressureSignal returns a Signal that is overloaded when the cgroup v2 cpu pressure, the ratio of time
+// that some tasks stall on cpu in the last 10 seconds, reaches threshold, using 1000m notation.
+// It's never overloaded on cgroup v1 because PSI is not available.
+// cgroup v2 cpu 压力过载信号，即最近 10 秒有任务等待 cpu 的时间占比，阀值使用 1000m 表示
+func CpuPressureSignal(threshold int64) Signal {
+	return ratioSignal(func() int64 {
+		return pressureOf(stat.Cgroup().CpuPressure)
+	}, threshold)
+}
+
+// MemoryPressureSignal returns a Signal that is overloaded when the cgroup v2 memory pressure, the ratio of time
+// that some tasks stall on memory in the last 10 seconds, reaches threshold, using 1000m notation.
+// It's never overloaded on cgroup v1 because PSI is not available.
+// cgroup v2 内存压力过载信号，即最近 10 秒有任务等待内存的时间占比，阀值使用 1000m 表示
+func MemoryPressureSignal(threshold int64) Signal {
+	return ratioSignal(func() int64 {
+		return pressureOf(stat.Cgroup().MemoryPressure)
+	}, threshold)
+}
+
+// GoroutineSignal returns a Signal that is overloaded when the number of goroutines reaches max,
+// it panics if max is not positive.
+// goroutine 数量过载信号，max 小于等于 0 时 panic
+func GoroutineSignal(max int) Signal {
+	if max <= 0 {
+		panic(fmt.Sprintf("load: goroutine signal max must be positive, got %d", max))
+	}
+
+	return SignalFunc(func() float64 {
+		return float64(runtime.NumGoroutine()) / float64(max)
+	})
+}
+
+// ProbeSignal returns a Signal that is overloaded when probe returns true.
+// 自定义探测过载信号
+func ProbeSignal(probe func() bool) Signal {
+	return SignalFunc(func() float64 {
+		if probe() {
+			return 1
+		}
+
+		return 0
+	})
+}
+
+// WeightedSignal returns a Signal with the weighted average pressure of the given Signals,
+// e.g. cpu at 0.9 with weight 2 and memory at 1.2 with weight 1 gives 1.0, which is overloaded.
+// 按权重组合多个过载信号，压力为各信号压力的加权平均值
+func WeightedSignal(signals ...Weighted) Signal {
+	return weightedSignal(signals)
+}
+
+// Pressure implements Signal.Pressure.
+func (ws weightedSignal) Pressure() float64 {
+	var pressure, weights float64
+	for _, s := range ws {
+		pressure += s.Signal.Pressure() * s.Weight
+		weights += s.Weight
+	}
+	if weights <= 0 {
+		return 0
+	}
+
+	return pressure / weights
+}
+
+// 使用量与阀值之比，阀值小于等于 0 时 panic
+func ratioSignal(usage func() int64, threshold int64) Signal {
+	if threshold <= 0 {
+		panic(fmt.Sprintf("load: signal threshold must be positive, got %d", threshold))
+	}
+
+	return SignalFunc(func() float64 {
+		return float64(usage()) / float64(threshold)
+	})
+}
+
+// PSI 的 avg10 为百分比，转换为 1000m 表示
+func pressureOf(p stat.Pressure) int64 {
+	return int64(p.Some.Avg10 * 10)
+}
@@ -0,0 +1,41 @@
+package stat
+
+import (
+	"path"
+
+	"gozerosource/code/core/stat/internal"
+)
+
+type (
+	// CgroupStats is the resource statistics of a cgroup, both v1 and v2 are supported.
+	// cgroup 资源统计：内存使用量及限制、cpu 限流、PSI 压力（仅 v2）
+	CgroupStats = internal.CgroupStats
+
+	// Pressure is the PSI (pressure stall information) of a resource, only available on cgroup v2.
+	// PSI 资源压力，仅 cgroup v2 支持
+	Pressure = internal.Pressure
+
+	// PressureLine is the some or full line of a Pressure.
+	PressureLine = internal.PressureLine
+)
+
+// Cgroup returns the CgroupStats of current cgroup sampled recently by the DefaultCollector.
+// 最近一次采样的 cgroup 资源统计，每 250ms 刷新一次
+func Cgroup() CgroupStats {
+	return DefaultCollector().Cgroup()
+}
+
+// ReadCgroupStats reads the CgroupStats from the cgroup hierarchy mounted at root,
+// like /sys/fs/cgroup, it's useful to test against the fixture directories.
+// 从 root 目录读取 cgroup 资源统计，可用于测试
+func ReadCgroupStats(root string) (CgroupStats, error) {
+	return internal.ReadCgroupStats(root)
+}
+
+// ReadProcessCgroupStats reads the CgroupStats of the cgroup that current process belongs to,
+// root is the filesystem root, root/proc/self/cgroup is used to resolve the cgroup
+// under root/sys/fs/cgroup, it's useful to test against the fixture directories.
+// 读取当前进程所属 cgroup 的资源统计，root 为文件系统根目录，可用于测试
+func ReadProcessCgroupStats(root string) (CgroupStats, error) {
+	return internal.ReadProcessCgroupStats(path.Join(root, "proc"), path.Join(root, "sys", "fs", "cgroup"))
+}
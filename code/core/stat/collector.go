@@ -0,0 +1,258 @@
+package stat
+
+import (
+	"log"
+	"path"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gozerosource/code/core/stat/internal"
+
+	"github.com/zeromicro/go-zero/core/lang"
+	"github.com/zeromicro/go-zero/core/threading"
+	"github.com/zeromicro/go-zero/core/timex"
+)
+
+const (
+	defaultRoot = "/"
+	// 250ms and 0.95 as beta will count the average cpu load for past 5 seconds
+	defaultRefreshInterval = time.Millisecond * 250
+	allRefreshInterval     = time.Minute
+	// moving average beta hyperparameter
+	beta = 0.95
+)
+
+type (
+	// CollectorOption customizes a Collector.
+	CollectorOption func(c *Collector)
+
+	// A Collector samples the cpu usage, the cgroup stats and the gc pauses periodically.
+	// It doesn't start any goroutine until Start is called.
+	// 资源采集器，周期性采集 cpu 使用率、cgroup 资源统计及 gc 暂停时间，调用 Start 后才开始采集
+	Collector struct {
+		// 文件系统根目录，从 root/proc 和 root/sys/fs/cgroup 读取数据
+		root       string
+		interval   time.Duration
+		logEnabled bool
+		// 保证采集不会并发执行
+		refreshLock sync.Mutex
+		cpu         *internal.CpuStat
+		// 上次采样时 gc 暂停的总时间
+		lastPauseTotal time.Duration
+		// 上次采样 gc 暂停时间的时间点
+		lastPauseTime time.Duration
+		cpuUsage      int64
+		memoryUsage   int64
+		gcPause       int64
+		// 最近一次采样的 cgroup 资源统计
+		cgroup atomic.Value
+		// 保护 done
+		lock sync.Mutex
+		// 非 nil 表示已经启动
+		done chan lang.PlaceholderType
+		// 等待采集 goroutine 退出
+		wg sync.WaitGroup
+	}
+)
+
+// NewCollector returns a Collector, it reads /proc and /sys/fs/cgroup by default.
+// 初始化资源采集器，默认读取 /proc 和 /sys/fs/cgroup
+func NewCollector(opts ...CollectorOption) *Collector {
+	c := &Collector{
+		root:       defaultRoot,
+		interval:   defaultRefreshInterval,
+		logEnabled: true,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.cpu = internal.NewCpuStat(c.procDir(), c.cgroupDir())
+	// 从创建时开始统计 gc 暂停时间
+	var stats debug.GCStats
+	debug.ReadGCStats(&stats)
+	c.lastPauseTotal = stats.PauseTotal
+	c.lastPauseTime = timex.Now()
+
+	return c
+}
+
+// WithRoot customizes the filesystem root, /proc and /sys/fs/cgroup are read under it,
+// it's useful to test against the fixture directories.
+// 自定义文件系统根目录，可用于测试
+func WithRoot(root string) CollectorOption {
+	return func(c *Collector) {
+		c.root = root
+	}
+}
+
+// WithRefreshInterval customizes the refresh interval, defaults to 250ms.
+// 自定义采集间隔，默认 250ms
+func WithRefreshInterval(interval time.Duration) CollectorOption {
+	return func(c *Collector) {
+		c.interval = interval
+	}
+}
+
+// WithLogEnabled enables or disables printing the usage every minute, enabled by default.
+// 是否每分钟输出资源使用情况，默认开启
+func WithLogEnabled(enabled bool) CollectorOption {
+	return func(c *Collector) {
+		c.logEnabled = enabled
+	}
+}
+
+// Start starts refreshing the stats in background, it does nothing if already started.
+// 开始后台采集，重复调用无影响
+func (c *Collector) Start() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.done != nil {
+		return
+	}
+
+	c.done = make(chan lang.PlaceholderType)
+	c.wg.Add(1)
+	go c.run(c.done)
+}
+
+// Stop stops refreshing the stats and waits for the background goroutine to exit,
+// the last sampled stats are kept.
+// 停止后台采集并等待采集 goroutine 退出，保留最后一次采样的结果
+func (c *Collector) Stop() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.done == nil {
+		return
+	}
+
+	close(c.done)
+	c.done = nil
+	c.wg.Wait()
+}
+
+// Refresh samples the stats once, it's called every refresh interval after Start.
+// 采集一次，Start 后每个采集间隔自动调用
+func (c *Collector) Refresh() {
+	c.refreshLock.Lock()
+	defer c.refreshLock.Unlock()
+
+	threading.RunSafe(c.refreshCpu)
+	threading.RunSafe(c.refreshCgroup)
+	threading.RunSafe(c.refreshGcPause)
+}
+
+// CpuUsage returns current cpu usage, using 1000m notation.
+// 当前 cpu 使用率的滑动平均值，1000m 表示
+func (c *Collector) CpuUsage() int64 {
+	return atomic.LoadInt64(&c.cpuUsage)
+}
+
+// MemoryUsage returns current memory usage against the cgroup memory limit, using 1000m notation,
+// returns 0 if the memory is not limited.
+// 当前内存使用量占 cgroup 内存限制的比例，1000m 表示，未限制时为 0
+func (c *Collector) MemoryUsage() int64 {
+	return atomic.LoadInt64(&c.memoryUsage)
+}
+
+// GcPause returns the moving average ratio of time spent in gc pauses, using 1000m notation.
+// gc 暂停时间占比的滑动平均值，1000m 表示
+func (c *Collector) GcPause() int64 {
+	return atomic.LoadInt64(&c.gcPause)
+}
+
+// Cgroup returns the CgroupStats sampled recently.
+// 最近一次采样的 cgroup 资源统计
+func (c *Collector) Cgroup() CgroupStats {
+	stats, _ := c.cgroup.Load().(CgroupStats)
+	return stats
+}
+
+func (c *Collector) run(done chan lang.PlaceholderType) {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	allTicker := time.NewTicker(allRefreshInterval)
+	defer allTicker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.Refresh()
+		case <-allTicker.C:
+			if c.logEnabled {
+				c.printUsage()
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+func (c *Collector) refreshCpu() {
+	// cpu滑动平均值
+	curUsage := c.cpu.Refresh()
+	prevUsage := atomic.LoadInt64(&c.cpuUsage)
+	// cpu = cpuᵗ⁻¹ * beta + cpuᵗ * (1 - beta)
+	// 滑动平均算法
+	usage := int64(float64(prevUsage)*beta + float64(curUsage)*(1-beta))
+	atomic.StoreInt64(&c.cpuUsage, usage)
+}
+
+func (c *Collector) refreshCgroup() {
+	stats, err := internal.ReadProcessCgroupStats(c.procDir(), c.cgroupDir())
+	if err != nil {
+		return
+	}
+
+	c.cgroup.Store(stats)
+	// 内存限制被移除时使用率归零
+	var usage int64
+	if stats.MemoryLimit > 0 {
+		usage = int64(stats.MemoryUsage * 1e3 / stats.MemoryLimit)
+	}
+	atomic.StoreInt64(&c.memoryUsage, usage)
+}
+
+func (c *Collector) refreshGcPause() {
+	var stats debug.GCStats
+	debug.ReadGCStats(&stats)
+	now := timex.Now()
+	// 按距离上次采样的实际时间计算，手动调用 Refresh 时不一定间隔 c.interval
+	elapsed := now - c.lastPauseTime
+	if elapsed <= 0 {
+		return
+	}
+
+	delta := stats.PauseTotal - c.lastPauseTotal
+	c.lastPauseTotal = stats.PauseTotal
+	c.lastPauseTime = now
+	// 采样周期内 gc 暂停时间的占比
+	curPause := int64(delta * 1e3 / elapsed)
+	prevPause := atomic.LoadInt64(&c.gcPause)
+	atomic.StoreInt64(&c.gcPause, int64(float64(prevPause)*beta+float64(curPause)*(1-beta)))
+}
+
+func (c *Collector) procDir() string {
+	return path.Join(c.root, "proc")
+}
+
+func (c *Collector) cgroupDir() string {
+	return path.Join(c.root, "sys", "fs", "cgroup")
+}
+
+func (c *Collector) printUsage() {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	log.Printf("CPU: %dm, MEMORY: Alloc=%.1fMi, TotalAlloc=%.1fMi, Sys=%.1fMi, NumGC=%d",
+		c.CpuUsage(), bToMb(m.Alloc), bToMb(m.TotalAlloc), bToMb(m.Sys), m.NumGC)
+}
+
+func bToMb(b uint64) float32 {
+	return float32(b) / 1024 / 1024
+}
@@ -2,7 +2,6 @@ package internal
 
 import (
 	"fmt"
-	"os"
 	"path"
 	"strconv"
 	"strings"
@@ -11,8 +10,6 @@ import (
 	"github.com/zeromicro/go-zero/core/lang"
 )
 
-const cgroupDir = "/sys/fs/cgroup"
-
 type cgroup struct {
 	cgroups map[string]string
 }
@@ -72,8 +69,9 @@ func (c *cgroup) cpus() ([]uint64, error) {
 	return parseUints(string(data))
 }
 
-func currentCgroup() (*cgroup, error) {
-	cgroupFile := fmt.Sprintf("/proc/%d/cgroup", os.Getpid())
+// 读取 procDir/self/cgroup 获取当前进程所在的 cgroup，cgroupDir 为 cgroup 的挂载目录
+func currentCgroup(procDir, cgroupDir string) (*cgroup, error) {
+	cgroupFile := path.Join(procDir, "self", "cgroup")
 	lines, err := iox.ReadTextLines(cgroupFile, iox.WithoutBlank())
 	if err != nil {
 		return nil, err
@@ -105,23 +103,6 @@ func currentCgroup() (*cgroup, error) {
 	}, nil
 }
 
-func parseUint(s string) (uint64, error) {
-	v, err := strconv.ParseInt(s, 10, 64)
-	if err != nil {
-		if err.(*strconv.NumError).Err == strconv.ErrRange {
-			return 0, nil
-		}
-
-		return 0, fmt.Errorf("cgroup: bad int format: %s", s)
-	}
-
-	if v < 0 {
-		return 0, nil
-	}
-
-	return uint64(v), nil
-}
-
 func parseUints(val string) ([]uint64, error) {
 	if val == "" {
 		return nil, nil
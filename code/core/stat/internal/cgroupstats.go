@@ -0,0 +1,312 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zeromicro/go-zero/core/iox"
+)
+
+const (
+	// cgroup v2 的根目录下有 cgroup.controllers 文件
+	cgroupV2Controllers = "cgroup.controllers"
+	// cgroup v1 未设置内存限制时 limit_in_bytes 为一个接近 int64 最大值的数
+	unlimitedMemory = 1 << 62
+)
+
+type (
+	// CgroupStats is the resource statistics of a cgroup, both v1 and v2 are supported.
+	// cgroup 资源统计，支持 v1 和 v2
+	CgroupStats struct {
+		// cgroup 版本，1 或 2
+		Version int
+		// 内存使用量，单位字节
+		MemoryUsage uint64
+		// 内存限制，单位字节，0 表示不限制
+		MemoryLimit uint64
+		// cpu 调度周期数
+		NrPeriods uint64
+		// cpu 被限流的周期数
+		NrThrottled uint64
+		// cpu 被限流的总时间
+		ThrottledTime time.Duration
+		// cpu 压力，仅 v2 支持
+		CpuPressure Pressure
+		// 内存压力，仅 v2 支持
+		MemoryPressure Pressure
+	}
+
+	// Pressure is the PSI (pressure stall information) of a resource.
+	// PSI 资源压力
+	// some: 至少有一个任务因等待资源而阻塞的时间占比
+	// full: 所有任务都因等待资源而阻塞的时间占比
+	Pressure struct {
+		Some PressureLine
+		Full PressureLine
+	}
+
+	// PressureLine is a line in the PSI file.
+	// PSI 文件中的一行，avg 为百分比
+	PressureLine struct {
+		Avg10  float64
+		Avg60  float64
+		Avg300 float64
+		Total  time.Duration
+	}
+)
+
+// ReadCgroupStats reads the CgroupStats from the cgroup hierarchy mounted at root,
+// like /sys/fs/cgroup, the files that don't exist are ignored.
+// 从 root 目录读取 cgroup 资源统计，不存在的文件会被忽略
+func ReadCgroupStats(root string) (CgroupStats, error) {
+	if exists(path.Join(root, cgroupV2Controllers)) {
+		return readCgroupV2Stats(root)
+	}
+
+	return readCgroupV1Stats(path.Join(root, "memory"), path.Join(root, "cpu"))
+}
+
+// ReadProcessCgroupStats reads the CgroupStats of the cgroup that current process belongs to,
+// the cgroup paths are resolved from procDir/self/cgroup under the hierarchy mounted at cgroupDir.
+// 读取当前进程所属 cgroup 的资源统计，cgroup 路径从 procDir/self/cgroup 中解析
+// 解析失败或者路径不存在时（比如容器未启用 cgroup namespace）使用挂载的根目录
+func ReadProcessCgroupStats(procDir, cgroupDir string) (CgroupStats, error) {
+	paths := processCgroupPaths(procDir)
+	if exists(path.Join(cgroupDir, cgroupV2Controllers)) {
+		// v2 的 controller 列表为空
+		return readCgroupV2Stats(resolveCgroupDir(cgroupDir, paths[""]))
+	}
+
+	return readCgroupV1Stats(resolveCgroupDir(path.Join(cgroupDir, "memory"), paths["memory"]),
+		resolveCgroupDir(path.Join(cgroupDir, "cpu"), paths["cpu"]))
+}
+
+func readCgroupV1Stats(memory, cpu string) (stats CgroupStats, err error) {
+	stats.Version = 1
+	if stats.MemoryUsage, err = readOptionalUint(path.Join(memory, "memory.usage_in_bytes")); err != nil {
+		return
+	}
+	if stats.MemoryLimit, err = readOptionalUint(path.Join(memory, "memory.limit_in_bytes")); err != nil {
+		return
+	}
+	// 未设置限制时为一个接近 int64 最大值的数
+	if stats.MemoryLimit >= unlimitedMemory {
+		stats.MemoryLimit = 0
+	}
+
+	cpuStat, err := readKeyValues(path.Join(cpu, "cpu.stat"))
+	if err != nil {
+		return
+	}
+	stats.NrPeriods = cpuStat["nr_periods"]
+	stats.NrThrottled = cpuStat["nr_throttled"]
+	stats.ThrottledTime = time.Duration(cpuStat["throttled_time"])
+
+	return
+}
+
+func readCgroupV2Stats(root string) (stats CgroupStats, err error) {
+	stats.Version = 2
+	if stats.MemoryUsage, err = readOptionalUint(path.Join(root, "memory.current")); err != nil {
+		return
+	}
+	if stats.MemoryLimit, err = readMemoryMax(path.Join(root, "memory.max")); err != nil {
+		return
+	}
+
+	cpuStat, err := readKeyValues(path.Join(root, "cpu.stat"))
+	if err != nil {
+		return
+	}
+	stats.NrPeriods = cpuStat["nr_periods"]
+	stats.NrThrottled = cpuStat["nr_throttled"]
+	stats.ThrottledTime = time.Duration(cpuStat["throttled_usec"]) * time.Microsecond
+
+	if stats.CpuPressure, err = readPressure(path.Join(root, "cpu.pressure")); err != nil {
+		return
+	}
+	stats.MemoryPressure, err = readPressure(path.Join(root, "memory.pressure"))
+
+	return
+}
+
+// 解析 procDir/self/cgroup，返回各 controller 所在的 cgroup 路径，v2 的 controller 为空字符串
+// 每行格式为 hierarchy-ID:controller-list:cgroup-path，比如 4:cpu,cpuacct:/docker/abc
+func processCgroupPaths(procDir string) map[string]string {
+	lines, err := iox.ReadTextLines(path.Join(procDir, "self", "cgroup"), iox.WithoutBlank())
+	if err != nil {
+		return nil
+	}
+
+	paths := make(map[string]string)
+	for _, line := range lines {
+		cols := strings.SplitN(line, ":", 3)
+		if len(cols) != 3 {
+			continue
+		}
+
+		for _, controller := range strings.Split(cols[1], ",") {
+			paths[controller] = cols[2]
+		}
+	}
+
+	return paths
+}
+
+// 拼接挂载目录和 cgroup 路径，不存在时使用挂载目录
+func resolveCgroupDir(mount, cgroupPath string) string {
+	if len(cgroupPath) == 0 {
+		return mount
+	}
+
+	dir := path.Join(mount, cgroupPath)
+	if !exists(dir) {
+		return mount
+	}
+
+	return dir
+}
+
+// 读取 memory.max，max 表示不限制
+func readMemoryMax(file string) (uint64, error) {
+	if !exists(file) {
+		return 0, nil
+	}
+
+	data, err := iox.ReadText(file)
+	if err != nil {
+		return 0, err
+	}
+	if data == "max" {
+		return 0, nil
+	}
+
+	return parseUint(data)
+}
+
+// 读取 key value 格式的文件，比如 cpu.stat
+func readKeyValues(file string) (map[string]uint64, error) {
+	if !exists(file) {
+		return nil, nil
+	}
+
+	lines, err := iox.ReadTextLines(file, iox.WithoutBlank())
+	if err != nil {
+		return nil, err
+	}
+
+	kvs := make(map[string]uint64)
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("cgroup: bad key value format: %s", line)
+		}
+
+		v, err := parseUint(fields[1])
+		if err != nil {
+			return nil, err
+		}
+
+		kvs[fields[0]] = v
+	}
+
+	return kvs, nil
+}
+
+// 读取 PSI 文件，格式如下
+// some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+// full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+func readPressure(file string) (pressure Pressure, err error) {
+	if !exists(file) {
+		return
+	}
+
+	lines, err := iox.ReadTextLines(file, iox.WithoutBlank())
+	if err != nil {
+		return
+	}
+
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		var pl PressureLine
+		for _, field := range fields[1:] {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				return pressure, fmt.Errorf("cgroup: bad pressure format: %s", line)
+			}
+
+			switch kv[0] {
+			case "avg10":
+				pl.Avg10, err = strconv.ParseFloat(kv[1], 64)
+			case "avg60":
+				pl.Avg60, err = strconv.ParseFloat(kv[1], 64)
+			case "avg300":
+				pl.Avg300, err = strconv.ParseFloat(kv[1], 64)
+			case "total":
+				var total uint64
+				total, err = parseUint(kv[1])
+				pl.Total = time.Duration(total) * time.Microsecond
+			}
+			if err != nil {
+				return pressure, fmt.Errorf("cgroup: bad pressure format: %s", line)
+			}
+		}
+
+		switch fields[0] {
+		case "some":
+			pressure.Some = pl
+		case "full":
+			pressure.Full = pl
+		}
+	}
+
+	return
+}
+
+func exists(file string) bool {
+	_, err := os.Stat(file)
+	return err == nil
+}
+
+// 读取整数，文件不存在时返回 0
+func readOptionalUint(file string) (uint64, error) {
+	if !exists(file) {
+		return 0, nil
+	}
+
+	return readUint(file)
+}
+
+func parseUint(s string) (uint64, error) {
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		if err.(*strconv.NumError).Err == strconv.ErrRange {
+			return 0, nil
+		}
+
+		return 0, fmt.Errorf("cgroup: bad int format: %s", s)
+	}
+
+	if v < 0 {
+		return 0, nil
+	}
+
+	return uint64(v), nil
+}
+
+func readUint(file string) (uint64, error) {
+	data, err := iox.ReadText(file)
+	if err != nil {
+		return 0, err
+	}
+
+	return parseUint(data)
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"path"
 	"strings"
 	"time"
 
@@ -15,83 +16,96 @@ const (
 	cpuFields = 8
 )
 
-var (
+// CpuStat calculates the cpu usage of current cgroup from the /proc and cgroup files.
+// 根据 /proc 和 cgroup 文件计算当前 cgroup 的 cpu 使用率
+type CpuStat struct {
+	procDir   string
+	cgroupDir string
 	preSystem uint64
 	preTotal  uint64
 	quota     float64
 	cores     uint64
-)
+}
 
+// NewCpuStat returns a CpuStat that reads /proc from procDir and the cgroup hierarchy from cgroupDir.
 // if /proc not present, ignore the cpu calculation, like wsl linux
-func init() {
-	cpus, err := perCpuUsage()
+func NewCpuStat(procDir, cgroupDir string) *CpuStat {
+	cs := &CpuStat{
+		procDir:   procDir,
+		cgroupDir: cgroupDir,
+	}
+
+	cpus, err := cs.perCpuUsage()
 	if err != nil {
 		log.Println(err)
-		return
+		return cs
 	}
 
-	cores = uint64(len(cpus))
-	sets, err := cpuSets()
+	cs.cores = uint64(len(cpus))
+	sets, err := cs.cpuSets()
 	if err != nil {
 		log.Println(err)
-		return
+		return cs
 	}
 
-	quota = float64(len(sets))
-	cq, err := cpuQuota()
+	cs.quota = float64(len(sets))
+	cq, err := cs.cpuQuota()
 	if err == nil {
 		if cq != -1 {
-			period, err := cpuPeriod()
+			period, err := cs.cpuPeriod()
 			if err != nil {
 				log.Println(err)
-				return
+				return cs
 			}
 
 			limit := float64(cq) / float64(period)
-			if limit < quota {
-				quota = limit
+			if limit < cs.quota {
+				cs.quota = limit
 			}
 		}
 	}
 
-	preSystem, err = systemCpuUsage()
+	cs.preSystem, err = cs.systemCpuUsage()
 	if err != nil {
 		log.Println(err)
-		return
+		return cs
 	}
 
-	preTotal, err = totalCpuUsage()
+	cs.preTotal, err = cs.totalCpuUsage()
 	if err != nil {
 		log.Println(err)
-		return
+		return cs
 	}
+
+	return cs
 }
 
-// RefreshCpu refreshes cpu usage and returns.
-func RefreshCpu() uint64 {
-	total, err := totalCpuUsage()
+// Refresh refreshes cpu usage and returns, it's not safe for concurrent use.
+// 刷新并返回 cpu 使用率，不支持并发调用
+func (cs *CpuStat) Refresh() uint64 {
+	total, err := cs.totalCpuUsage()
 	if err != nil {
 		return 0
 	}
-	system, err := systemCpuUsage()
+	system, err := cs.systemCpuUsage()
 	if err != nil {
 		return 0
 	}
 
 	var usage uint64
-	cpuDelta := total - preTotal
-	systemDelta := system - preSystem
+	cpuDelta := total - cs.preTotal
+	systemDelta := system - cs.preSystem
 	if cpuDelta > 0 && systemDelta > 0 {
-		usage = uint64(float64(cpuDelta*cores*1e3) / (float64(systemDelta) * quota))
+		usage = uint64(float64(cpuDelta*cs.cores*1e3) / (float64(systemDelta) * cs.quota))
 	}
-	preSystem = system
-	preTotal = total
+	cs.preSystem = system
+	cs.preTotal = total
 
 	return usage
 }
 
-func cpuQuota() (int64, error) {
-	cg, err := currentCgroup()
+func (cs *CpuStat) cpuQuota() (int64, error) {
+	cg, err := currentCgroup(cs.procDir, cs.cgroupDir)
 	if err != nil {
 		return 0, err
 	}
@@ -99,8 +113,8 @@ func cpuQuota() (int64, error) {
 	return cg.cpuQuotaUs()
 }
 
-func cpuPeriod() (uint64, error) {
-	cg, err := currentCgroup()
+func (cs *CpuStat) cpuPeriod() (uint64, error) {
+	cg, err := currentCgroup(cs.procDir, cs.cgroupDir)
 	if err != nil {
 		return 0, err
 	}
@@ -108,8 +122,8 @@ func cpuPeriod() (uint64, error) {
 	return cg.cpuPeriodUs()
 }
 
-func cpuSets() ([]uint64, error) {
-	cg, err := currentCgroup()
+func (cs *CpuStat) cpuSets() ([]uint64, error) {
+	cg, err := currentCgroup(cs.procDir, cs.cgroupDir)
 	if err != nil {
 		return nil, err
 	}
@@ -117,8 +131,8 @@ func cpuSets() ([]uint64, error) {
 	return cg.cpus()
 }
 
-func perCpuUsage() ([]uint64, error) {
-	cg, err := currentCgroup()
+func (cs *CpuStat) perCpuUsage() ([]uint64, error) {
+	cg, err := currentCgroup(cs.procDir, cs.cgroupDir)
 	if err != nil {
 		return nil, err
 	}
@@ -126,8 +140,8 @@ func perCpuUsage() ([]uint64, error) {
 	return cg.acctUsagePerCpu()
 }
 
-func systemCpuUsage() (uint64, error) {
-	lines, err := iox.ReadTextLines("/proc/stat", iox.WithoutBlank())
+func (cs *CpuStat) systemCpuUsage() (uint64, error) {
+	lines, err := iox.ReadTextLines(path.Join(cs.procDir, "stat"), iox.WithoutBlank())
 	if err != nil {
 		return 0, err
 	}
@@ -156,9 +170,9 @@ func systemCpuUsage() (uint64, error) {
 	return 0, errors.New("bad stats format")
 }
 
-func totalCpuUsage() (usage uint64, err error) {
+func (cs *CpuStat) totalCpuUsage() (usage uint64, err error) {
 	var cg *cgroup
-	if cg, err = currentCgroup(); err != nil {
+	if cg, err = currentCgroup(cs.procDir, cs.cgroupDir); err != nil {
 		return
 	}
 
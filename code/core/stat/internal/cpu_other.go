@@ -3,7 +3,15 @@
 
 package internal
 
-// RefreshCpu returns cpu usage, always returns 0 on systems other than linux.
-func RefreshCpu() uint64 {
+// CpuStat calculates the cpu usage, it's not supported on systems other than linux.
+type CpuStat struct{}
+
+// NewCpuStat returns a CpuStat, the dirs are ignored on systems other than linux.
+func NewCpuStat(procDir, cgroupDir string) *CpuStat {
+	return new(CpuStat)
+}
+
+// Refresh returns cpu usage, always returns 0 on systems other than linux.
+func (cs *CpuStat) Refresh() uint64 {
 	return 0
 }
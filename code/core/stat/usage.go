@@ -1,69 +1,39 @@
 package stat
 
-import (
-	"log"
-	"runtime"
-	"sync/atomic"
-	"time"
+import "sync"
 
-	"gozerosource/code/core/stat/internal"
-	"gozerosource/code/core/syncx"
-
-	"github.com/zeromicro/go-zero/core/threading"
-)
-
-const (
-	// 250ms and 0.95 as beta will count the average cpu load for past 5 seconds
-	cpuRefreshInterval = time.Millisecond * 250
-	allRefreshInterval = time.Minute
-	// moving average beta hyperparameter
-	beta = 0.95
+var (
+	defaultCollector *Collector
+	defaultOnce      sync.Once
 )
 
-var logEnabled = syncx.ForAtomicBool(true)
-
-var cpuUsage int64
-
-func init() {
-	go func() {
-		cpuTicker := time.NewTicker(cpuRefreshInterval)
-		defer cpuTicker.Stop()
-		allTicker := time.NewTicker(allRefreshInterval)
-		defer allTicker.Stop()
+// DefaultCollector returns the Collector that reads the real /proc and cgroup files,
+// it's started on first use, so importing this package doesn't start any goroutine.
+// 默认的资源采集器，首次使用时才开始采集，仅引入包不会启动任何 goroutine
+func DefaultCollector() *Collector {
+	defaultOnce.Do(func() {
+		defaultCollector = NewCollector()
+		defaultCollector.Start()
+	})
 
-		for {
-			select {
-			case <-cpuTicker.C:
-				threading.RunSafe(func() {
-					// cpu滑动平均值
-					curUsage := internal.RefreshCpu()
-					prevUsage := atomic.LoadInt64(&cpuUsage)
-					// cpu = cpuᵗ⁻¹ * beta + cpuᵗ * (1 - beta)
-					// 滑动平均算法
-					usage := int64(float64(prevUsage)*beta + float64(curUsage)*(1-beta))
-					atomic.StoreInt64(&cpuUsage, usage)
-				})
-			case <-allTicker.C:
-				if logEnabled.True() {
-					printUsage()
-				}
-			}
-		}
-	}()
+	return defaultCollector
 }
 
-// CpuUsage returns current cpu usage.
+// CpuUsage returns current cpu usage of the DefaultCollector.
 func CpuUsage() int64 {
-	return atomic.LoadInt64(&cpuUsage)
+	return DefaultCollector().CpuUsage()
 }
 
-func bToMb(b uint64) float32 {
-	return float32(b) / 1024 / 1024
+// MemoryUsage returns current memory usage against the cgroup memory limit of the DefaultCollector,
+// using 1000m notation, returns 0 if the memory is not limited.
+// 当前内存使用量占 cgroup 内存限制的比例，1000m 表示，未限制时为 0
+func MemoryUsage() int64 {
+	return DefaultCollector().MemoryUsage()
 }
 
-func printUsage() {
-	var m runtime.MemStats
-	runtime.ReadMemStats(&m)
-	log.Printf("CPU: %dm, MEMORY: Alloc=%.1fMi, TotalAlloc=%.1fMi, Sys=%.1fMi, NumGC=%d",
-		CpuUsage(), bToMb(m.Alloc), bToMb(m.TotalAlloc), bToMb(m.Sys), m.NumGC)
+// GcPause returns the moving average ratio of time spent in gc pauses of the DefaultCollector,
+// using 1000m notation.
+// gc 暂停时间占比的滑动平均值，1000m 表示
+func GcPause() int64 {
+	return DefaultCollector().GcPause()
 }
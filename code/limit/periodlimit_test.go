@@ -59,3 +59,37 @@ func Test_PeriodLimit(t *testing.T) {
 	wait.Wait()
 	fmt.Printf("allowed: %d, denied: %d, qps: %d\n", allowed, denied, (allowed+denied)/seconds)
 }
+
+func Test_PeriodLimitResult(t *testing.T) {
+	store := redis.New("127.0.0.1:6379")
+	if !store.Ping() {
+		t.Skip("redis is not available")
+	}
+
+	const quota = 3
+	lmt := limit.NewPeriodLimit(10, quota, store, "period-limit-result")
+	key := strconv.FormatInt(time.Now().UnixNano(), 10)
+	for i := 0; i < quota+1; i++ {
+		result, err := lmt.TakeResult(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Printf("%+v\n", result)
+		remaining := quota - i - 1
+		if remaining < 0 {
+			remaining = 0
+		}
+		if result.Limit != quota || result.Remaining != remaining {
+			t.Errorf("take %d: %+v", i, result)
+		}
+		if result.ResetAfter <= 0 || result.ResetAfter > 10*time.Second {
+			t.Errorf("take %d: reset after %v", i, result.ResetAfter)
+		}
+		if i < quota && (!result.Allowed() || result.RetryAfter != 0) {
+			t.Errorf("take %d should be allowed: %+v", i, result)
+		}
+		if i == quota && (result.Allowed() || result.RetryAfter != result.ResetAfter) {
+			t.Errorf("take %d should be over quota: %+v", i, result)
+		}
+	}
+}
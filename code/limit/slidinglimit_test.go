@@ -0,0 +1,82 @@
+package limit_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"gozerosource/code/core/limit"
+
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+func Test_SlidingLimit(t *testing.T) {
+	store := redis.New("127.0.0.1:6379")
+	if !store.Ping() {
+		t.Skip("redis is not available")
+	}
+
+	const quota = 5
+	lmt := limit.NewSlidingLimit(1, quota, store, "sliding-limit")
+	key := fmt.Sprint(time.Now().UnixNano())
+	var codes []int
+	for i := 0; i < quota+2; i++ {
+		code, err := lmt.Take(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		codes = append(codes, code)
+	}
+	fmt.Println(codes)
+	for i, code := range codes {
+		want := limit.Allowed
+		switch {
+		case i == quota-1:
+			want = limit.HitQuota
+		case i >= quota:
+			want = limit.OverQuota
+		}
+		if code != want {
+			t.Errorf("take %d: %d; want %d", i, code, want)
+		}
+	}
+
+	// 两个窗口之后，之前的请求不再计入
+	time.Sleep(2 * time.Second)
+	if code, err := lmt.Take(key); err != nil || code != limit.Allowed {
+		t.Errorf("take after 2 periods: %d, %v", code, err)
+	}
+}
+
+func Test_SlidingLimitResult(t *testing.T) {
+	store := redis.New("127.0.0.1:6379")
+	if !store.Ping() {
+		t.Skip("redis is not available")
+	}
+
+	const quota = 2
+	lmt := limit.NewSlidingLimit(1, quota, store, "sliding-limit-result")
+	key := fmt.Sprint(time.Now().UnixNano())
+	for i := 0; i < quota; i++ {
+		result, err := lmt.TakeResult(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Allowed() || result.Remaining != quota-i-1 || result.RetryAfter != 0 {
+			t.Errorf("take %d: %+v", i, result)
+		}
+	}
+
+	result, err := lmt.TakeResult(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Printf("%+v\n", result)
+	if result.Allowed() || result.Remaining != 0 {
+		t.Fatalf("take should be over quota: %+v", result)
+	}
+	// 当前窗口已满，需要等到下一个窗口才能重试
+	if result.RetryAfter <= 0 || result.RetryAfter > 2*time.Second {
+		t.Errorf("retry after: %v", result.RetryAfter)
+	}
+}
@@ -1,8 +1,12 @@
 package limit_test
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"runtime"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -11,6 +15,7 @@ import (
 	"gozerosource/code/core/limit"
 
 	"github.com/zeromicro/go-zero/core/stores/redis"
+	xrate "golang.org/x/time/rate"
 )
 
 func Test_TokenLimiter(t *testing.T) {
@@ -55,3 +60,217 @@ func Test_TokenLimiter(t *testing.T) {
 	wait.Wait()
 	fmt.Printf("allowed: %d, denied: %d, qps: %d\n", allowed, denied, (allowed+denied)/seconds)
 }
+
+func Test_TokenLimiterMillis(t *testing.T) {
+	store := redis.New("127.0.0.1:6379")
+	if !store.Ping() {
+		t.Skip("redis is not available")
+	}
+
+	for name, opts := range map[string][]limit.TokenLimiterOption{
+		"client time": nil,
+		"redis time":  {limit.WithRedisTime()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			key := fmt.Sprintf("token-limiter-millis-%d", time.Now().UnixNano())
+			// 每 20ms 生产一个token，按秒生产时需要等到下一秒才能获取
+			limiter := limit.NewTokenLimiter(50, 1, store, key, opts...)
+			if !limiter.Allow() {
+				t.Fatal("first request should be allowed")
+			}
+			if limiter.Allow() {
+				t.Fatal("second request should be denied")
+			}
+			time.Sleep(25 * time.Millisecond)
+			if !limiter.Allow() {
+				t.Error("request should be allowed after 25ms")
+			}
+		})
+	}
+}
+
+// redis 不可用时使用进程内限流器，行为一致
+func Test_TokenLimiterReserve(t *testing.T) {
+	store := redis.New("127.0.0.1:6379")
+	key := fmt.Sprintf("token-limiter-reserve-%d", time.Now().UnixNano())
+	// 每秒生产一个token
+	limiter := limit.NewTokenLimiter(1, 1, store, key)
+
+	now := time.Now()
+	r := limiter.ReserveN(now, 1)
+	if !r.OK() || r.DelayFrom(now) != 0 {
+		t.Fatalf("first reservation: %v, %v", r.OK(), r.DelayFrom(now))
+	}
+	r = limiter.ReserveN(now, 1)
+	delay := r.DelayFrom(now)
+	fmt.Println("delay:", delay)
+	if !r.OK() || delay < 900*time.Millisecond || delay > 1100*time.Millisecond {
+		t.Fatalf("second reservation: %v, %v", r.OK(), delay)
+	}
+	if r := limiter.ReserveN(now, 2); r.OK() {
+		t.Fatal("reservation exceeds burst should fail")
+	}
+
+	// 取消后归还token，下一次预定只需等待 1s
+	r.CancelAt(now)
+	r = limiter.ReserveN(now, 1)
+	if delay := r.DelayFrom(now); delay < 900*time.Millisecond || delay > 1100*time.Millisecond {
+		t.Fatalf("reservation after cancel: %v", delay)
+	}
+	r.CancelAt(now)
+
+	// 等待时间超过截止时间时直接返回错误
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(ctx); err == nil {
+		t.Fatal("wait should exceed the deadline")
+	}
+
+	start := time.Now()
+	if err := limiter.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println("waited:", time.Since(start))
+	if err := limiter.WaitN(context.Background(), 2); err == nil {
+		t.Fatal("wait exceeds burst should fail")
+	}
+}
+
+// 截止时间已过但 context 尚未结束时，不应无限等待
+func Test_TokenLimiterWaitPastDeadline(t *testing.T) {
+	store := redis.New("127.0.0.1:6379")
+	key := fmt.Sprintf("token-limiter-deadline-%d", time.Now().UnixNano())
+	limiter := limit.NewTokenLimiter(1, 1, store, key)
+	if !limiter.Allow() {
+		t.Fatal("first token should be allowed")
+	}
+
+	ctx := pastDeadlineContext{Context: context.Background()}
+	start := time.Now()
+	if err := limiter.Wait(ctx); err == nil {
+		t.Fatal("wait should exceed the deadline")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("wait returned after %v; want immediately", elapsed)
+	}
+}
+
+// 截止时间已过，但 Done 还未关闭，模拟检查 Done 与计算等待时间之间到期的情况
+type pastDeadlineContext struct {
+	context.Context
+}
+
+func (pastDeadlineContext) Deadline() (time.Time, bool) {
+	return time.Now().Add(-time.Second), true
+}
+
+// redis 不可用时使用进程内限流器，只有放行状态及重试等待时间
+func Test_TokenLimiterResult(t *testing.T) {
+	store := redis.New("127.0.0.1:6379")
+	key := fmt.Sprintf("token-limiter-result-%d", time.Now().UnixNano())
+	// 每 100ms 生产一个token
+	limiter := limit.NewTokenLimiter(10, 2, store, key)
+
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		result := limiter.TakeResult(now, 1)
+		fmt.Printf("%+v\n", result)
+		if !result.Allowed() || result.Limit != 2 || result.RetryAfter != 0 {
+			t.Fatalf("take %d: %+v", i, result)
+		}
+	}
+
+	result := limiter.TakeResult(now, 1)
+	fmt.Printf("%+v\n", result)
+	if result.Allowed() || result.State != limit.OverQuota {
+		t.Fatalf("take should be over quota: %+v", result)
+	}
+	if result.RetryAfter < 90*time.Millisecond || result.RetryAfter > 110*time.Millisecond {
+		t.Errorf("retry after: %v", result.RetryAfter)
+	}
+	if result := limiter.TakeResult(now, 3); result.Allowed() || result.RetryAfter != xrate.InfDuration {
+		t.Errorf("take exceeds burst: %+v", result)
+	}
+}
+
+func Test_TokenKeyLimiterInvalidRate(t *testing.T) {
+	store := redis.New("127.0.0.1:6379")
+	for _, c := range []struct{ rate, burst int }{{0, 1}, {-1, 1}, {1, 0}} {
+		if _, err := limit.NewTokenKeyLimiter(c.rate, c.burst, store, "token-key"); err != limit.ErrInvalidRate {
+			t.Errorf("rate %d, burst %d: %v; want %v", c.rate, c.burst, err, limit.ErrInvalidRate)
+		}
+	}
+	if _, err := limit.NewTokenKeyLimiter(1, 1, store, "token-key"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_TokenKeyLimiterSharedMonitor(t *testing.T) {
+	// 使用已关闭的端口模拟redis故障
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	limiter, err := limit.NewTokenKeyLimiter(1, 1, redis.New(addr), "token-key-monitor")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const keys = 100
+	for i := 0; i < keys; i++ {
+		result, err := limiter.TakeResult(strconv.Itoa(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Allowed() {
+			t.Errorf("key %d: %+v; want allowed by the in-process limiter", i, result)
+		}
+	}
+	// 进程内限流器仍然按 key 限流
+	if result, _ := limiter.TakeResult("0"); result.Allowed() {
+		t.Errorf("key 0 taken twice: %+v; want over quota", result)
+	}
+
+	buf := make([]byte, 1<<20)
+	stacks := string(buf[:runtime.Stack(buf, true)])
+	if n := strings.Count(stacks, "limit.(*redisMonitor).waitForRedis"); n != 1 {
+		t.Errorf("monitor goroutines: %d; want 1", n)
+	}
+}
+
+func Test_FormatSeconds(t *testing.T) {
+	for _, c := range []struct {
+		d    time.Duration
+		want string
+	}{
+		{-time.Second, "0"},
+		{0, "0"},
+		{time.Millisecond, "1"},
+		{time.Second, "1"},
+		{1500 * time.Millisecond, "2"},
+		{xrate.InfDuration - 1, "9223372037"},
+	} {
+		if secs, ok := limit.FormatSeconds(c.d); !ok || secs != c.want {
+			t.Errorf("%v: %s, %t; want %s", int64(c.d), secs, ok, c.want)
+		}
+	}
+
+	// 请求数量超过桶容量时永远无法放行
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	limiter := limit.NewTokenLimiter(1, 1, redis.New(addr), "format-seconds")
+	result := limiter.TakeResult(time.Now(), 2)
+	if result.Allowed() {
+		t.Fatalf("take exceeds burst: %+v", result)
+	}
+	if secs, ok := limit.FormatSeconds(result.RetryAfter); ok {
+		t.Errorf("retry after exceeding burst: %s; want infinite", secs)
+	}
+}
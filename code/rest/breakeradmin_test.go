@@ -0,0 +1,107 @@
+package rest_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"gozerosource/code/core/breaker"
+	"gozerosource/code/rest/rest"
+	"gozerosource/code/rest/rest/handler"
+)
+
+func Test_BreakerAdminHandler(t *testing.T) {
+	const name = "admin-controlled"
+	b := breaker.GetBreaker(name)
+	defer breaker.ResetControl(name)
+
+	post := func(form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/breakers", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp := httptest.NewRecorder()
+		handler.BreakerAdminHandler(resp, req)
+		return resp
+	}
+	type control struct {
+		Name string
+		Mode string
+	}
+	list := func() map[string]*control {
+		resp := httptest.NewRecorder()
+		handler.BreakerAdminHandler(resp, httptest.NewRequest(http.MethodGet, "/admin/breakers", nil))
+		if resp.Code != http.StatusOK {
+			t.Fatalf("list: %d", resp.Code)
+		}
+		var statuses []struct {
+			Name    string
+			Control *control
+		}
+		if err := json.Unmarshal(resp.Body.Bytes(), &statuses); err != nil {
+			t.Fatal(err)
+		}
+		controls := make(map[string]*control)
+		for _, s := range statuses {
+			controls[s.Name] = s.Control
+		}
+		return controls
+	}
+
+	controls := list()
+	if c, ok := controls[name]; !ok || c != nil {
+		t.Fatalf("list: %v; want %s without control", controls, name)
+	}
+
+	// 强制熔断
+	resp := post(url.Values{"name": {name}, "action": {"open"}, "ttl": {"1m"}})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("force open: %d %s", resp.Code, resp.Body.String())
+	}
+	if err := b.Do(func() error { return nil }); err != breaker.ErrServiceUnavailable {
+		t.Errorf("Do: %v; want %v", err, breaker.ErrServiceUnavailable)
+	}
+	c, ok := breaker.GetControl(name)
+	if !ok || c.Mode != breaker.ControlForceOpen || c.TTL <= 0 || c.TTL > time.Minute {
+		t.Errorf("GetControl() = %+v, %t; want force open within 1m", c, ok)
+	}
+	if controls := list(); controls[name] == nil || controls[name].Mode != "force-open" {
+		t.Errorf("list: %v; want force open control of %s", controls, name)
+	}
+
+	// 错误的参数不改变控制项
+	for _, form := range []url.Values{
+		{"action": {"open"}},
+		{"name": {name}, "action": {"bogus"}},
+		{"name": {name}, "action": {"drop"}, "ratio": {"2"}},
+		{"name": {name}, "action": {"close"}, "ttl": {"-1s"}},
+		{"name": {name}, "action": {"close"}, "ttl": {"forever"}},
+	} {
+		if resp := post(form); resp.Code != http.StatusBadRequest {
+			t.Errorf("%v: %d; want %d", form, resp.Code, http.StatusBadRequest)
+		}
+	}
+	if c, ok := breaker.GetControl(name); !ok || c.Mode != breaker.ControlForceOpen {
+		t.Errorf("GetControl() = %+v, %t; want force open", c, ok)
+	}
+
+	resp = httptest.NewRecorder()
+	handler.BreakerAdminHandler(resp, httptest.NewRequest(http.MethodPut, "/admin/breakers", nil))
+	if resp.Code != http.StatusMethodNotAllowed {
+		t.Errorf("put: %d; want %d", resp.Code, http.StatusMethodNotAllowed)
+	}
+
+	if resp := post(url.Values{"name": {name}, "action": {"reset"}}); resp.Code != http.StatusOK {
+		t.Fatalf("reset: %d", resp.Code)
+	}
+	if err := b.Do(func() error { return nil }); err != nil {
+		t.Errorf("Do after reset: %v", err)
+	}
+
+	routes := rest.BreakerAdminRoutes("/admin/breakers")
+	if len(routes) != 2 || routes[0].Method != http.MethodGet || routes[1].Method != http.MethodPost {
+		t.Errorf("routes: %+v", routes)
+	}
+}
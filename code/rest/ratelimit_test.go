@@ -0,0 +1,186 @@
+package rest_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gozerosource/code/core/breaker"
+	"gozerosource/code/core/clock"
+	"gozerosource/code/core/limit"
+	"gozerosource/code/core/load"
+	"gozerosource/code/rest/rest/handler"
+
+	"github.com/zeromicro/go-zero/core/stat"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+func Test_RateLimitHandler(t *testing.T) {
+	const quota = 2
+	counts := make(map[string]int)
+	limiter := limit.KeyLimiterFunc(func(key string) (limit.Result, error) {
+		counts[key]++
+		result := limit.Result{
+			State:      limit.Allowed,
+			Limit:      quota,
+			Remaining:  quota - counts[key],
+			ResetAfter: 1500 * time.Millisecond,
+		}
+		if result.Remaining < 0 {
+			result.State = limit.OverQuota
+			result.Remaining = 0
+			result.RetryAfter = result.ResetAfter
+		}
+		return result, nil
+	})
+	h := handler.RateLimitHandler(limiter, handler.ClientIPKey)(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		resp := httptest.NewRecorder()
+		h.ServeHTTP(resp, req)
+		if resp.Code != want {
+			t.Fatalf("request %d: %d; want %d", i, resp.Code, want)
+		}
+		if resp.Header().Get("X-RateLimit-Limit") != "2" || resp.Header().Get("X-RateLimit-Reset") != "2" {
+			t.Errorf("request %d: headers %v", i, resp.Header())
+		}
+		if want == http.StatusTooManyRequests && resp.Header().Get("Retry-After") != "2" {
+			t.Errorf("request %d: Retry-After %q", i, resp.Header().Get("Retry-After"))
+		}
+	}
+	if counts["10.0.0.1"] != 3 {
+		t.Errorf("counts: %v", counts)
+	}
+
+	// 忽略可被伪造的 X-Forwarded-For
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "10.0.0.2, 10.0.0.3")
+	if key := handler.ClientIPKey(req); key != "10.0.0.1" {
+		t.Errorf("client ip: %s", key)
+	}
+
+	// 仅信任来自代理的 X-Forwarded-For，使用最右侧的非代理地址
+	keyFunc := handler.TrustedProxyClientIPKey("10.0.0.1", "192.168.0.0/16")
+	for _, c := range []struct {
+		remote string
+		xff    []string
+		want   string
+	}{
+		{"172.16.0.1:1234", []string{"1.1.1.1"}, "172.16.0.1"},
+		{"10.0.0.1:1234", nil, "10.0.0.1"},
+		{"10.0.0.1:1234", []string{"1.1.1.1, 2.2.2.2"}, "2.2.2.2"},
+		{"10.0.0.1:1234", []string{"1.1.1.1, 2.2.2.2, 192.168.1.1"}, "2.2.2.2"},
+		{"10.0.0.1:1234", []string{"1.1.1.1", "2.2.2.2, 192.168.1.1"}, "2.2.2.2"},
+		{"10.0.0.1:1234", []string{"192.168.1.2, 192.168.1.1"}, "10.0.0.1"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = c.remote
+		for _, xff := range c.xff {
+			req.Header.Add("X-Forwarded-For", xff)
+		}
+		if key := keyFunc(req); key != c.want {
+			t.Errorf("remote %s, xff %v: %s; want %s", c.remote, c.xff, key, c.want)
+		}
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("invalid trusted proxy should panic")
+			}
+		}()
+		handler.TrustedProxyClientIPKey("10.0.0.0/33")
+	}()
+
+	// key 为空时不限流
+	h = handler.RateLimitHandler(limiter, handler.JwtClaimKey("uid"))(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {}))
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/", nil))
+	if resp.Code != http.StatusOK || len(resp.Header().Get("X-RateLimit-Limit")) > 0 {
+		t.Errorf("request without key should not be limited: %d", resp.Code)
+	}
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req = req.WithContext(context.WithValue(req.Context(), "uid", 1))
+	if key := handler.JwtClaimKey("uid")(req); key != "1" {
+		t.Errorf("jwt claim key: %s", key)
+	}
+}
+
+// 请求数量超过桶容量时永远无法放行，不返回 Retry-After
+func Test_RateLimitExceedsBurst(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	tokens := limit.NewTokenLimiter(1, 1, redis.New(addr), "exceeds-burst")
+	limiter := limit.KeyLimiterFunc(func(key string) (limit.Result, error) {
+		return tokens.TakeResult(time.Now(), 2), nil
+	})
+	h := handler.RateLimitHandler(limiter, handler.ClientIPKey)(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, req)
+	if resp.Code != http.StatusTooManyRequests {
+		t.Fatalf("status: %d; want %d", resp.Code, http.StatusTooManyRequests)
+	}
+	if retry, ok := resp.Header()["Retry-After"]; ok {
+		t.Errorf("Retry-After: %v; want omitted", retry)
+	}
+	if resp.Header().Get("X-RateLimit-Limit") != "1" {
+		t.Errorf("headers: %v", resp.Header())
+	}
+}
+
+// 限流拒绝的请求不计入熔断及降载统计
+func Test_RateLimitNotRecorded(t *testing.T) {
+	clk := clock.NewFakeClock()
+	shedder := load.NewAdaptiveShedder(
+		load.WithClock(clk),
+		load.WithWindow(time.Second),
+		load.WithBuckets(10),
+		load.WithLogEnabled(false),
+	)
+	metrics := stat.NewMetrics("ratelimit-not-recorded")
+	limiter := limit.KeyLimiterFunc(func(key string) (limit.Result, error) {
+		return limit.Result{State: limit.OverQuota, Limit: 1, RetryAfter: time.Second}, nil
+	})
+	h := handler.BreakerHandler(http.MethodGet, "/not-recorded", metrics)(
+		handler.SheddingHandler(shedder, metrics)(
+			handler.RateLimitHandler(limiter, handler.HeaderKey("X-User"))(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusOK)
+				}))))
+
+	for i := 0; i < 100; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/not-recorded", nil)
+		req.Header.Set("X-User", "u1")
+		resp := httptest.NewRecorder()
+		h.ServeHTTP(resp, req)
+		if resp.Code != http.StatusTooManyRequests {
+			t.Fatalf("request %d: %d; want %d", i, resp.Code, http.StatusTooManyRequests)
+		}
+	}
+
+	clk.Advance(200 * time.Millisecond)
+	if stats := shedder.Stats(); stats.Flying != 0 || stats.MaxPass != 1 || stats.MinRt != 1000 {
+		t.Errorf("shedder stats: %+v; want nothing recorded", stats)
+	}
+	if stats := breaker.GetBreaker("GET:///not-recorded").Stats(); stats.Total != 0 {
+		t.Errorf("breaker stats: %+v; want nothing recorded", stats)
+	}
+}
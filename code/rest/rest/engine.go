@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"time"
 
+	"gozerosource/code/core/load"
 	"gozerosource/code/rest/rest/internal/response"
 
 	"gozerosource/code/rest/rest/handler"
@@ -15,13 +16,9 @@ import (
 
 	"github.com/justinas/alice"
 	"github.com/zeromicro/go-zero/core/codec"
-	"github.com/zeromicro/go-zero/core/load"
 	"github.com/zeromicro/go-zero/core/stat"
 )
 
-// use 1000m to represent 100%
-const topCpuUsage = 1000
-
 // ErrSignatureConfig is an error that indicates bad config for signature.
 var ErrSignatureConfig = errors.New("bad config for Signature")
 
@@ -31,8 +28,7 @@ type engine struct {
 	unauthorizedCallback handler.UnauthorizedCallback // 权限验证失败回调
 	unsignedCallback     handler.UnsignedCallback     // 签名验证失败回调
 	middlewares          []Middleware                 // 中间件
-	shedder              load.Shedder                 // 降载处理器
-	priorityShedder      load.Shedder                 // 更高降载阀值处理器
+	shedder              load.Shedder                 // 降载处理器，按请求优先级降载
 	tlsConfig            *tls.Config                  // tls 配置
 }
 
@@ -42,11 +38,8 @@ func newEngine(c RestConf) *engine {
 		conf: c,
 	}
 	if c.CpuThreshold > 0 {
-		// 加载服务降载处理器
+		// 加载服务降载处理器，优先级路由使用更高的降载阀值
 		srv.shedder = load.NewAdaptiveShedder(load.WithCpuThreshold(c.CpuThreshold))
-		// 加载更高降载阀值处理器
-		srv.priorityShedder = load.NewAdaptiveShedder(load.WithCpuThreshold(
-			(c.CpuThreshold + topCpuUsage) >> 1))
 	}
 
 	return srv
@@ -105,7 +98,8 @@ func (ng *engine) bindRoute(fr featuredRoutes, router httpx.Router, metrics *sta
 		handler.PrometheusHandler(route.Path),
 		handler.MaxConns(ng.conf.MaxConns),
 		handler.BreakerHandler(route.Method, route.Path, metrics),
-		handler.SheddingHandler(ng.getShedder(fr.priority), metrics),
+		handler.PriorityHandler(ng.getPriority(fr.priority)),
+		handler.SheddingHandler(ng.shedder, metrics),
 		handler.TimeoutHandler(ng.checkedTimeout(fr.timeout)),
 		handler.RecoverHandler,
 		handler.MetricHandler(metrics),
@@ -113,6 +107,9 @@ func (ng *engine) bindRoute(fr featuredRoutes, router httpx.Router, metrics *sta
 		handler.GunzipHandler,
 	)
 	chain = ng.appendAuthHandler(fr, chain, verifier)
+	// 限流放在权限验证之后，以便使用 jwt 声明作为限流的 key
+	// 限流拒绝的 429 请求不计入熔断及降载统计
+	chain = chain.Append(handler.RateLimitHandler(fr.rateLimit.limiter, fr.rateLimit.keyFunc))
 
 	for _, middleware := range ng.middlewares {
 		chain = chain.Append(convertMiddleware(middleware))
@@ -164,12 +161,13 @@ func (ng *engine) getLogHandler() func(http.Handler) http.Handler {
 	return handler.LogHandler
 }
 
-func (ng *engine) getShedder(priority bool) load.Shedder {
-	if priority && ng.priorityShedder != nil {
-		return ng.priorityShedder
+// 路由的降载优先级
+func (ng *engine) getPriority(priority bool) load.Priority {
+	if priority {
+		return load.PriorityCritical
 	}
 
-	return ng.shedder
+	return load.PriorityDefault
 }
 
 // notFoundHandler returns a middleware that handles 404 not found requests.
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"gozerosource/code/core/breaker"
+	"gozerosource/code/rest/rest/httpx"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+const (
+	breakerActionOpen  = "open"
+	breakerActionClose = "close"
+	breakerActionDrop  = "drop"
+	breakerActionReset = "reset"
+)
+
+type (
+	// 熔断器状态
+	breakerStatus struct {
+		breaker.Stats
+		Control *breaker.Control `json:",omitempty"`
+	}
+
+	// 熔断器控制请求
+	breakerControlRequest struct {
+		Name   string  `form:"name"`
+		Action string  `form:"action,options=open|close|drop|reset"`
+		Ratio  float64 `form:"ratio,optional"`
+		TTL    string  `form:"ttl,default=1m"` // 有效时间，格式如 30s、1m
+	}
+)
+
+// ErrInvalidBreakerTTL is returned when the ttl of a breaker control is not a positive duration.
+var ErrInvalidBreakerTTL = errors.New("ttl must be a positive duration, like 30s or 1m")
+
+// BreakerAdminHandler lists the registered breakers on GET,
+// and forces a breaker open, closed, or injects a drop ratio on POST.
+// POST form: name=X&action=open|close|drop|reset&ratio=0.5&ttl=1m
+// 熔断器管理接口，用于故障演练
+func BreakerAdminHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		listBreakers(w)
+	case http.MethodPost:
+		controlBreaker(w, r)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func listBreakers(w http.ResponseWriter) {
+	list := breaker.ListBreakers()
+	statuses := make([]breakerStatus, 0, len(list))
+	for _, b := range list {
+		status := breakerStatus{
+			Stats: b.Stats(),
+		}
+		if c, ok := breaker.GetControl(b.Name()); ok {
+			status.Control = &c
+		}
+		statuses = append(statuses, status)
+	}
+
+	httpx.OkJson(w, statuses)
+}
+
+func controlBreaker(w http.ResponseWriter, r *http.Request) {
+	var req breakerControlRequest
+	if err := httpx.ParseForm(r, &req); err != nil {
+		httpx.Error(w, err)
+		return
+	}
+	ttl, err := time.ParseDuration(req.TTL)
+	if err != nil || ttl <= 0 {
+		httpx.Error(w, ErrInvalidBreakerTTL)
+		return
+	}
+
+	switch req.Action {
+	case breakerActionOpen:
+		breaker.ForceOpen(req.Name, ttl)
+	case breakerActionClose:
+		breaker.ForceClose(req.Name, ttl)
+	case breakerActionDrop:
+		if err := breaker.InjectDropRatio(req.Name, req.Ratio, ttl); err != nil {
+			httpx.Error(w, err)
+			return
+		}
+	case breakerActionReset:
+		breaker.ResetControl(req.Name)
+	}
+
+	logx.Infof("[http] breaker control, name: %s, action: %s, ratio: %.2f, ttl: %s, from: %s",
+		req.Name, req.Action, req.Ratio, ttl, httpx.GetRemoteAddr(r))
+	httpx.Ok(w)
+}
@@ -5,10 +5,10 @@ import (
 	"net/http"
 	"strings"
 
+	"gozerosource/code/core/breaker"
 	"gozerosource/code/rest/rest/httpx"
 	"gozerosource/code/rest/rest/internal/response"
 
-	"github.com/zeromicro/go-zero/core/breaker"
 	"github.com/zeromicro/go-zero/core/logx"
 	"github.com/zeromicro/go-zero/core/stat"
 )
@@ -18,27 +18,48 @@ const breakerSeparator = "://"
 // BreakerHandler returns a break circuit middleware.
 // 断路器中间件
 func BreakerHandler(method, path string, metrics *stat.Metrics) func(http.Handler) http.Handler {
-	brk := breaker.NewBreaker(breaker.WithName(strings.Join([]string{method, path}, breakerSeparator)))
+	// 注册到熔断器注册表，以便通过 BreakerAdminHandler 查看和控制
+	brk := breaker.GetBreaker(strings.Join([]string{method, path}, breakerSeparator))
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			promise, err := brk.Allow()
-			if err != nil {
+			cw := &response.WithCodeResponseWriter{Writer: w}
+			_ = brk.DoWithFallbackClassifier(func() error {
+				next.ServeHTTP(cw, r)
+				return statusError(cw.Code)
+			}, func(err error) error {
 				metrics.AddDrop()
 				logx.Errorf("[http] dropped, %s - %s - %s",
 					r.RequestURI, httpx.GetRemoteAddr(r), r.UserAgent())
 				w.WriteHeader(http.StatusServiceUnavailable)
-				return
-			}
-
-			cw := &response.WithCodeResponseWriter{Writer: w}
-			defer func() {
-				if cw.Code < http.StatusInternalServerError {
-					promise.Accept()
-				} else {
-					promise.Reject(fmt.Sprintf("%d %s", cw.Code, http.StatusText(cw.Code)))
-				}
-			}()
-			next.ServeHTTP(cw, r)
+				return err
+			}, classifyStatus)
 		})
 	}
 }
+
+// 响应码，交给 classifyStatus 判定请求结果，同时作为失败原因
+type statusError int
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("%d %s", int(e), http.StatusText(int(e)))
+}
+
+// 5xx 为失败，429 为限流拒绝，请求未被处理，不计入统计
+func classifyStatus(err error) breaker.Outcome {
+	code, _ := err.(statusError)
+	switch {
+	case code == http.StatusTooManyRequests:
+		return breaker.Outcome{
+			Accepted: true,
+		}
+	case code < http.StatusInternalServerError:
+		return breaker.Outcome{
+			Accepted: true,
+			Weight:   1,
+		}
+	default:
+		return breaker.Outcome{
+			Weight: 1,
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gozerosource/code/core/limit"
+	"gozerosource/code/rest/rest/httpx"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+const (
+	rateLimitLimitHeader     = "X-RateLimit-Limit"
+	rateLimitRemainingHeader = "X-RateLimit-Remaining"
+	rateLimitResetHeader     = "X-RateLimit-Reset"
+	retryAfterHeader         = "Retry-After"
+	xForwardedForHeader      = "X-Forwarded-For"
+)
+
+// RateLimitKeyFunc defines the method to extract the rate limit key from the request,
+// the request is not limited if the key is empty.
+// 从请求中提取限流的 key，key 为空时不限流
+type RateLimitKeyFunc func(r *http.Request) string
+
+// RateLimitHandler returns a middleware that limits the requests by the key extracted by keyFunc.
+// It responds 429 with Retry-After header if the request is over quota, Retry-After is omitted
+// if the request can never be allowed, the X-RateLimit-* headers are always set.
+// The requests are allowed if the limiter fails, like redis is down.
+// 限流中间件，超出配额时返回 429 及 Retry-After 响应头，永远无法放行时不返回 Retry-After
+// 限流器出错时放行请求，比如 redis 故障
+func RateLimitHandler(limiter limit.KeyLimiter, keyFunc RateLimitKeyFunc) func(http.Handler) http.Handler {
+	if limiter == nil || keyFunc == nil {
+		return func(next http.Handler) http.Handler {
+			return next
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := keyFunc(r)
+			if len(key) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			result, err := limiter.TakeResult(key)
+			if err != nil {
+				logx.Errorf("[http] rate limiter failed, key: %s, error: %v", key, err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			header := w.Header()
+			header.Set(rateLimitLimitHeader, strconv.Itoa(result.Limit))
+			header.Set(rateLimitRemainingHeader, strconv.Itoa(result.Remaining))
+			if reset, ok := limit.FormatSeconds(result.ResetAfter); ok {
+				header.Set(rateLimitResetHeader, reset)
+			}
+			if !result.Allowed() {
+				logx.Errorf("[http] rate limited, key: %s, %s - %s - %s",
+					key, r.RequestURI, httpx.GetRemoteAddr(r), r.UserAgent())
+				// 永远无法放行时不返回 Retry-After
+				if retry, ok := limit.FormatSeconds(result.RetryAfter); ok {
+					header.Set(retryAfterHeader, retry)
+				}
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientIPKey is a RateLimitKeyFunc that uses the host of the remote address as the key,
+// X-Forwarded-For is ignored because it can be forged by the clients, use TrustedProxyClientIPKey
+// if the server is behind proxies.
+// 使用客户端 ip 作为限流的 key，忽略可被客户端伪造的 X-Forwarded-For
+// 服务部署在代理之后时使用 TrustedProxyClientIPKey
+func ClientIPKey(r *http.Request) string {
+	return remoteHost(r)
+}
+
+// TrustedProxyClientIPKey returns a RateLimitKeyFunc that uses the client ip as the key,
+// X-Forwarded-For is only read if the remote address is one of the trusted proxies,
+// then the right-most address that is not a trusted proxy is used.
+// The proxies are ips or cidrs like 10.0.0.0/8, it panics on invalid proxies.
+// 使用客户端 ip 作为限流的 key，仅当请求来自可信代理时读取 X-Forwarded-For
+// 从右往左跳过可信代理，使用第一个不可信的地址，左侧的地址可被客户端伪造
+// proxies 为 ip 或者 cidr，格式错误时 panic
+func TrustedProxyClientIPKey(proxies ...string) RateLimitKeyFunc {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				panic(fmt.Sprintf("invalid trusted proxy: %s", proxy))
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			panic(fmt.Sprintf("invalid trusted proxy: %s", proxy))
+		}
+		nets = append(nets, ipNet)
+	}
+
+	trusted := func(addr string) bool {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return false
+		}
+		for _, ipNet := range nets {
+			if ipNet.Contains(ip) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return func(r *http.Request) string {
+		host := remoteHost(r)
+		if !trusted(host) {
+			return host
+		}
+
+		// 多个 X-Forwarded-For 请求头按顺序拼接
+		var hops []string
+		for _, val := range r.Header.Values(xForwardedForHeader) {
+			hops = append(hops, strings.Split(val, ",")...)
+		}
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if len(hop) > 0 && !trusted(hop) {
+				return hop
+			}
+		}
+
+		return host
+	}
+}
+
+// 请求的远端地址，不含端口
+func remoteHost(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+
+	return r.RemoteAddr
+}
+
+// HeaderKey returns a RateLimitKeyFunc that uses the value of the given header as the key.
+// 使用指定请求头的值作为限流的 key
+func HeaderKey(name string) RateLimitKeyFunc {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// JwtClaimKey returns a RateLimitKeyFunc that uses the value of the given jwt claim as the key,
+// it should be used on the routes with jwt authentication.
+// 使用指定 jwt 声明的值作为限流的 key，需要开启 jwt 验证
+func JwtClaimKey(claim string) RateLimitKeyFunc {
+	return func(r *http.Request) string {
+		val := r.Context().Value(claim)
+		if val == nil {
+			return ""
+		}
+
+		return fmt.Sprint(val)
+	}
+}
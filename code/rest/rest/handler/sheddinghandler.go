@@ -4,10 +4,10 @@ import (
 	"net/http"
 	"sync"
 
+	"gozerosource/code/core/load"
 	"gozerosource/code/rest/rest/httpx"
 	"gozerosource/code/rest/rest/internal/response"
 
-	"github.com/zeromicro/go-zero/core/load"
 	"github.com/zeromicro/go-zero/core/logx"
 	"github.com/zeromicro/go-zero/core/stat"
 )
@@ -33,7 +33,7 @@ func SheddingHandler(shedder load.Shedder, metrics *stat.Metrics) func(http.Hand
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			sheddingStat.IncrementTotal()
-			promise, err := shedder.Allow()
+			promise, err := shedder.AllowCtx(r.Context())
 			if err != nil {
 				metrics.AddDrop()
 				sheddingStat.IncrementDrop()
@@ -45,18 +45,43 @@ func SheddingHandler(shedder load.Shedder, metrics *stat.Metrics) func(http.Hand
 
 			cw := &response.WithCodeResponseWriter{Writer: w}
 			defer func() {
-				if cw.Code == http.StatusServiceUnavailable {
-					promise.Fail()
-				} else {
+				outcome := outcomeOf(cw.Code)
+				if outcome == load.OutcomeSuccess {
 					sheddingStat.IncrementPass()
-					promise.Pass()
 				}
+				promise.Done(outcome)
 			}()
 			next.ServeHTTP(cw, r)
 		})
 	}
 }
 
+// PriorityHandler returns a middleware that sets the load shedding priority of the requests.
+// 设置请求的降载优先级，需放在 SheddingHandler 之前
+func PriorityHandler(priority load.Priority) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(load.NewPriorityContext(r.Context(), priority)))
+		})
+	}
+}
+
+// 根据响应码判断请求结果
+// 503 一般为超时或者过载，其它 5xx 为失败，失败及超时的请求不计入响应时间统计
+// 429 为限流拒绝，请求未被处理，不计入统计
+func outcomeOf(code int) load.Outcome {
+	switch {
+	case code == http.StatusTooManyRequests:
+		return load.OutcomeIgnored
+	case code == http.StatusServiceUnavailable:
+		return load.OutcomeTimeout
+	case code >= http.StatusInternalServerError:
+		return load.OutcomeError
+	default:
+		return load.OutcomeSuccess
+	}
+}
+
 func ensureSheddingStat() {
 	lock.Lock()
 	if sheddingStat == nil {
@@ -7,6 +7,7 @@ import (
 	"path"
 	"time"
 
+	"gozerosource/code/core/limit"
 	"gozerosource/code/rest/rest/internal/cors"
 
 	"gozerosource/code/rest/rest/handler"
@@ -99,6 +100,25 @@ func (s *Server) Use(middleware Middleware) {
 	s.ngin.use(middleware)
 }
 
+// BreakerAdminRoutes returns the routes of handler.BreakerAdminHandler on path, GET lists the breakers
+// and POST controls them. Protect the routes with RouteOption like WithJwt or WithSignature,
+// e.g. server.AddRoutes(rest.BreakerAdminRoutes("/admin/breakers"), rest.WithJwt(secret)).
+// 熔断器管理接口的路由，用于故障演练，需要通过 WithJwt、WithSignature 等方式保护
+func BreakerAdminRoutes(path string) []Route {
+	return []Route{
+		{
+			Method:  http.MethodGet,
+			Path:    path,
+			Handler: handler.BreakerAdminHandler,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    path,
+			Handler: handler.BreakerAdminHandler,
+		},
+	}
+}
+
 // ToMiddleware converts the given handler to a Middleware.
 // 将 handle 转换为 Middleware
 func ToMiddleware(handler func(next http.Handler) http.Handler) Middleware {
@@ -219,6 +239,17 @@ func WithPriority() RouteOption {
 	}
 }
 
+// WithRateLimit returns a RouteOption to limit the requests by the key extracted by keyFunc,
+// like handler.ClientIPKey, handler.TrustedProxyClientIPKey, handler.HeaderKey and handler.JwtClaimKey.
+// The routes share the quota of the same key, use different limiters for separated quotas.
+// 给路由开启限流，超出配额时返回 429，同一个限流器的路由共享配额
+func WithRateLimit(limiter limit.KeyLimiter, keyFunc handler.RateLimitKeyFunc) RouteOption {
+	return func(r *featuredRoutes) {
+		r.rateLimit.limiter = limiter
+		r.rateLimit.keyFunc = keyFunc
+	}
+}
+
 // WithRouter returns a RunOption that make server run with given router.
 // server 使用给定路由
 func WithRouter(router httpx.Router) RunOption {
@@ -3,6 +3,9 @@ package rest
 import (
 	"net/http"
 	"time"
+
+	"gozerosource/code/core/limit"
+	"gozerosource/code/rest/rest/handler"
 )
 
 type (
@@ -35,12 +38,19 @@ type (
 		enabled       bool // 是否开启
 	}
 
+	// 限流
+	rateLimitSetting struct {
+		limiter limit.KeyLimiter         // 限流器
+		keyFunc handler.RateLimitKeyFunc // 限流 key 提取函数
+	}
+
 	// 特色路由
 	featuredRoutes struct {
 		timeout   time.Duration    // 超时处理
 		priority  bool             // 是否开启优先
 		jwt       jwtSetting       // jwt 配置
 		signature signatureSetting // 签名配置
+		rateLimit rateLimitSetting // 限流配置
 		routes    []Route          // 指定路由
 	}
 )
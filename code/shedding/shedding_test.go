@@ -1,13 +1,16 @@
 package shedding_test
 
 import (
+	"context"
 	"fmt"
+	"math"
 	"math/rand"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"gozerosource/code/core/clock"
 	"gozerosource/code/core/load"
 	"gozerosource/code/core/stat"
 
@@ -76,3 +79,365 @@ func cpuFull() {
 		}(i)
 	}
 }
+
+func Test_SheddingWithClock(t *testing.T) {
+	load.DisableLog()
+	clk := clock.NewFakeClock()
+	var dropped []load.Stats
+	// cpu 阈值为 0，始终处于过载状态
+	// 窗口内没有数据时最大并发数为 1s 内的桶数量，即 10
+	shedder := load.NewAdaptiveShedder(
+		load.WithClock(clk),
+		load.WithWindow(time.Second),
+		load.WithBuckets(buckets),
+		load.WithCpuThreshold(0),
+		load.WithSink(func(stats load.Stats) {
+			dropped = append(dropped, stats)
+		}),
+	)
+	var promises []load.Promise
+	for i := 0; i < 100; i++ {
+		promise, err := shedder.Allow()
+		if err != nil {
+			t.Fatalf("Allow: %v", err)
+		}
+		promises = append(promises, promise)
+	}
+	// 平均并发数和当前并发数都超过最大并发数，丢弃请求
+	for _, promise := range promises[:60] {
+		promise.Fail()
+	}
+	if _, err := shedder.Allow(); err != load.ErrServiceOverloaded {
+		t.Fatalf("Allow: %v; want %v", err, load.ErrServiceOverloaded)
+	}
+	if len(dropped) != 1 || dropped[0].Flying != 40 || dropped[0].MaxFlight != 10 {
+		t.Fatalf("dropped: %+v; want 1 drop with flying 40 and maxFlight 10", dropped)
+	}
+	if stats := shedder.Stats(); stats.Drops != 1 || !stats.Hot {
+		t.Fatalf("Stats: %+v; want 1 drop and hot", stats)
+	}
+	// 并发数降下来后恢复
+	for _, promise := range promises[60:] {
+		promise.Fail()
+	}
+	clk.Advance(time.Second)
+	if _, err := shedder.Allow(); err != nil {
+		t.Fatalf("Allow: %v", err)
+	}
+}
+
+func Test_SheddingOptions(t *testing.T) {
+	// 单个降载器关闭后允许所有请求
+	disabled := load.NewAdaptiveShedder(
+		load.WithEnabled(false),
+		load.WithCpuThreshold(0),
+	)
+	for i := 0; i < 100; i++ {
+		if _, err := disabled.Allow(); err != nil {
+			t.Fatalf("Allow: %v", err)
+		}
+	}
+
+	clk := clock.NewFakeClock()
+	shedder := load.NewAdaptiveShedder(
+		load.WithClock(clk),
+		load.WithWindow(time.Second),
+		load.WithBuckets(buckets),
+		load.WithCpuThreshold(0),
+		load.WithCoolOff(100*time.Millisecond),
+		load.WithFlyingBeta(0.5),
+		load.WithLogEnabled(false),
+	)
+	var promises []load.Promise
+	for i := 0; i < 100; i++ {
+		promise, err := shedder.Allow()
+		if err != nil {
+			t.Fatalf("Allow: %v", err)
+		}
+		promises = append(promises, promise)
+	}
+	for _, promise := range promises[:10] {
+		promise.Fail()
+	}
+	if _, err := shedder.Allow(); err != load.ErrServiceOverloaded {
+		t.Fatalf("Allow: %v; want %v", err, load.ErrServiceOverloaded)
+	}
+
+	// 调高阀值后，冷却期内仍然丢弃请求
+	shedder.SetCpuThreshold(1000000)
+	if _, err := shedder.Allow(); err != load.ErrServiceOverloaded {
+		t.Fatalf("Allow: %v; want %v", err, load.ErrServiceOverloaded)
+	}
+	// 负数阀值被忽略，冷却期结束后恢复
+	shedder.SetCpuThreshold(-1)
+	clk.Advance(200 * time.Millisecond)
+	if _, err := shedder.Allow(); err != nil {
+		t.Fatalf("Allow: %v", err)
+	}
+}
+
+func Test_SheddingSignals(t *testing.T) {
+	cpu := load.SignalFunc(func() float64 {
+		return 0.9
+	})
+	memory := load.SignalFunc(func() float64 {
+		return 1.2
+	})
+	// (0.9*2 + 1.2*1) / 3 = 1
+	if p := load.WeightedSignal(
+		load.Weighted{Signal: cpu, Weight: 2},
+		load.Weighted{Signal: memory, Weight: 1},
+	).Pressure(); math.Abs(p-1) > 1e-9 {
+		t.Errorf("Pressure: %v; want 1", p)
+	}
+	if p := load.GoroutineSignal(1).Pressure(); p < 1 {
+		t.Errorf("Pressure: %v; want >= 1", p)
+	}
+	// 阀值小于等于 0 时 panic，而不是始终过载或者永不过载
+	for name, fn := range map[string]func(){
+		"goroutine": func() { load.GoroutineSignal(0) },
+		"cpu":       func() { load.CpuSignal(0) },
+		"memory":    func() { load.MemorySignal(-1) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s signal with non-positive threshold should panic", name)
+				}
+			}()
+			fn()
+		}()
+	}
+
+	// cpu 未过载，自定义探测过载时丢弃请求
+	var overloaded int32
+	shedder := load.NewAdaptiveShedder(
+		load.WithClock(clock.NewFakeClock()),
+		load.WithWindow(time.Second),
+		load.WithBuckets(buckets),
+		load.WithCpuThreshold(1000000),
+		load.WithLogEnabled(false),
+		load.WithSignals(load.ProbeSignal(func() bool {
+			return atomic.LoadInt32(&overloaded) == 1
+		})),
+	)
+	var promises []load.Promise
+	for i := 0; i < 100; i++ {
+		promise, err := shedder.Allow()
+		if err != nil {
+			t.Fatalf("Allow: %v", err)
+		}
+		promises = append(promises, promise)
+	}
+	for _, promise := range promises[:60] {
+		promise.Fail()
+	}
+	if _, err := shedder.Allow(); err != nil {
+		t.Fatalf("Allow: %v", err)
+	}
+	atomic.StoreInt32(&overloaded, 1)
+	if _, err := shedder.Allow(); err != load.ErrServiceOverloaded {
+		t.Fatalf("Allow: %v; want %v", err, load.ErrServiceOverloaded)
+	}
+}
+
+func Test_SheddingPriority(t *testing.T) {
+	// 阀值为 900m 时，sheddable 的阀值为 800m，critical 的阀值为 950m
+	// cpu 固定为 850m，只有 sheddable 过载
+	shedder := load.NewAdaptiveShedder(
+		load.WithClock(clock.NewFakeClock()),
+		load.WithWindow(time.Second),
+		load.WithBuckets(buckets),
+		load.WithCpuThreshold(900),
+		load.WithCpuUsage(func() int64 {
+			return 850
+		}),
+		load.WithLogEnabled(false),
+	)
+	ctx := context.Background()
+	sheddable := load.NewPriorityContext(ctx, load.PrioritySheddable)
+	critical := load.NewPriorityContext(ctx, load.PriorityCritical)
+	var promises []load.Promise
+	for i := 0; i < 100; i++ {
+		promise, err := shedder.AllowCtx(critical)
+		if err != nil {
+			t.Fatalf("AllowCtx critical: %v", err)
+		}
+		promises = append(promises, promise)
+	}
+	for _, promise := range promises[:60] {
+		promise.Fail()
+	}
+
+	if _, err := shedder.AllowCtx(sheddable); err != load.ErrServiceOverloaded {
+		t.Fatalf("AllowCtx sheddable: %v; want %v", err, load.ErrServiceOverloaded)
+	}
+	if _, err := shedder.AllowCtx(critical); err != nil {
+		t.Fatalf("AllowCtx critical: %v", err)
+	}
+
+	stats := shedder.Stats()
+	fmt.Printf("%+v\n", stats.Classes)
+	if len(stats.Classes) != 3 || stats.Classes[load.PrioritySheddable].Drops != 1 ||
+		!stats.Classes[load.PrioritySheddable].Hot || stats.Classes[load.PriorityCritical].Drops != 0 {
+		t.Fatalf("Classes: %+v", stats.Classes)
+	}
+	if p, ok := load.ParsePriority("Critical"); !ok || p != load.PriorityCritical {
+		t.Errorf("ParsePriority: %v, %t", p, ok)
+	}
+}
+
+func Test_GradientLimiter(t *testing.T) {
+	clk := clock.NewFakeClock()
+	limiter := load.NewGradientLimiter(
+		load.WithClock(clk),
+		load.WithInitialLimit(10),
+		load.WithLimits(1, 100),
+		load.WithSampleWindow(50*time.Millisecond),
+		load.WithLogEnabled(false),
+	)
+	// 按当前并发限制发起请求，rtt 后全部成功
+	run := func(rounds int, rtt time.Duration) int64 {
+		for i := 0; i < rounds; i++ {
+			var promises []load.Promise
+			for {
+				promise, err := limiter.Allow()
+				if err != nil {
+					break
+				}
+				promises = append(promises, promise)
+			}
+			clk.Advance(rtt)
+			for _, promise := range promises {
+				promise.Pass()
+			}
+		}
+		return limiter.Stats().MaxFlight
+	}
+
+	if _, err := limiter.AllowCtx(context.Background()); err != nil {
+		t.Fatalf("AllowCtx: %v", err)
+	}
+	stats := limiter.Stats()
+	if stats.MaxFlight != 10 || stats.Flying != 1 {
+		t.Fatalf("Stats: %+v; want limit 10 and flying 1", stats)
+	}
+
+	// rtt 稳定时并发限制增长
+	grown := run(50, 10*time.Millisecond)
+	// rtt 变长时并发限制降低
+	shrunk := run(50, 50*time.Millisecond)
+	fmt.Println("grown", grown, "shrunk", shrunk)
+	if grown <= 10 || shrunk >= grown {
+		t.Fatalf("grown: %d, shrunk: %d; want 10 < grown > shrunk", grown, shrunk)
+	}
+	if stats := limiter.Stats(); stats.Drops == 0 {
+		t.Fatalf("Stats: %+v; want drops", stats)
+	}
+}
+
+// rtt 为 0 的采样窗口被跳过，并发限制不会变为 NaN
+func Test_GradientLimiterZeroRtt(t *testing.T) {
+	clk := clock.NewFakeClock()
+	limiter := load.NewGradientLimiter(
+		load.WithClock(clk),
+		load.WithInitialLimit(10),
+		load.WithLimits(1, 100),
+		load.WithSampleWindow(50*time.Millisecond),
+		load.WithLogEnabled(false),
+	)
+	pass := func(rtt time.Duration) {
+		promise, err := limiter.Allow()
+		if err != nil {
+			t.Fatalf("Allow: %v", err)
+		}
+		clk.Advance(rtt)
+		promise.Pass()
+	}
+
+	for i := 0; i < 3; i++ {
+		clk.Advance(time.Second)
+		pass(0)
+	}
+	if stats := limiter.Stats(); stats.MaxFlight != 10 || stats.MinRt != 0 {
+		t.Fatalf("Stats: %+v; want limit 10 and no rtt", stats)
+	}
+
+	for i := 0; i < 3; i++ {
+		pass(time.Second)
+	}
+	stats := limiter.Stats()
+	if math.IsNaN(stats.MinRt) || stats.MinRt <= 0 || stats.MaxFlight < 1 || stats.MaxFlight > 100 {
+		t.Fatalf("Stats: %+v; want positive rtt and limit in [1, 100]", stats)
+	}
+}
+
+func Test_GradientLimiterOptions(t *testing.T) {
+	maxFlight := func(opts ...load.ShedderOption) int64 {
+		return load.NewGradientLimiter(append(opts, load.WithLogEnabled(false))...).Stats().MaxFlight
+	}
+	// 初始并发限制超出范围时取边界值
+	if limit := maxFlight(load.WithInitialLimit(500), load.WithLimits(1, 100)); limit != 100 {
+		t.Errorf("limit: %d; want 100", limit)
+	}
+	if limit := maxFlight(load.WithInitialLimit(5), load.WithLimits(10, 100)); limit != 10 {
+		t.Errorf("limit: %d; want 10", limit)
+	}
+	// 错误的配置被忽略
+	if limit := maxFlight(load.WithLimits(100, 10), load.WithInitialLimit(-1)); limit != 20 {
+		t.Errorf("limit: %d; want default 20", limit)
+	}
+	if limit := maxFlight(load.WithLimits(0, 10), load.WithInitialLimit(50)); limit != 50 {
+		t.Errorf("limit: %d; want 50", limit)
+	}
+
+	// 只适用于另一种降载器的配置直接 panic
+	for name, fn := range map[string]func(){
+		"adaptive with limits": func() {
+			load.NewAdaptiveShedder(load.WithLimits(1, 100))
+		},
+		"gradient with cpu threshold": func() {
+			load.NewGradientLimiter(load.WithCpuThreshold(900))
+		},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s should panic", name)
+				}
+			}()
+			fn()
+		}()
+	}
+}
+
+func Test_SheddingOutcome(t *testing.T) {
+	clk := clock.NewFakeClock()
+	shedder := load.NewAdaptiveShedder(
+		load.WithClock(clk),
+		load.WithWindow(time.Second),
+		load.WithBuckets(buckets),
+		load.WithLogEnabled(false),
+	)
+	outcomes := []load.Outcome{
+		load.OutcomeError, load.OutcomeError, load.OutcomeError,
+		load.OutcomeTimeout, load.OutcomeTimeout, load.OutcomeSuccess,
+	}
+	for _, outcome := range outcomes {
+		promise, err := shedder.Allow()
+		if err != nil {
+			t.Fatalf("Allow: %v", err)
+		}
+		clk.Advance(time.Millisecond)
+		promise.Done(outcome)
+	}
+	// 跳过当前桶
+	clk.Advance(time.Second / buckets)
+
+	stats := shedder.Stats()
+	fmt.Printf("%+v\n", stats)
+	// 失败及超时的请求不计入 maxPass 及 minRt
+	if stats.Errors != 3 || stats.Timeouts != 2 || stats.MaxPass != 1 || stats.MinRt != 1 {
+		t.Fatalf("Stats: %+v; want 3 errors, 2 timeouts, maxPass 1 and minRt 1", stats)
+	}
+}
@@ -0,0 +1,172 @@
+package shedding_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"gozerosource/code/core/stat"
+)
+
+func Test_CgroupV1Stats(t *testing.T) {
+	stats, err := stat.ReadCgroupStats("testdata/cgroup/v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Printf("%+v\n", stats)
+	if stats.Version != 1 || stats.MemoryUsage != 100<<20 || stats.MemoryLimit != 200<<20 {
+		t.Errorf("memory: %+v", stats)
+	}
+	if stats.NrPeriods != 1000 || stats.NrThrottled != 25 || stats.ThrottledTime != 1500*time.Millisecond {
+		t.Errorf("cpu: %+v", stats)
+	}
+}
+
+func Test_CgroupV2Stats(t *testing.T) {
+	stats, err := stat.ReadCgroupStats("testdata/cgroup/v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Printf("%+v\n", stats)
+	if stats.Version != 2 || stats.MemoryUsage != 50<<20 || stats.MemoryLimit != 100<<20 {
+		t.Errorf("memory: %+v", stats)
+	}
+	if stats.NrPeriods != 400 || stats.NrThrottled != 40 || stats.ThrottledTime != 2*time.Second {
+		t.Errorf("cpu: %+v", stats)
+	}
+	want := stat.PressureLine{
+		Avg10:  12.5,
+		Avg60:  8,
+		Avg300: 2.25,
+		Total:  123456 * time.Microsecond,
+	}
+	if stats.CpuPressure.Some != want {
+		t.Errorf("cpu pressure: %+v; want %+v", stats.CpuPressure.Some, want)
+	}
+	if stats.MemoryPressure.Full.Avg10 != 1 || stats.MemoryPressure.Some.Total != 65432*time.Microsecond {
+		t.Errorf("memory pressure: %+v", stats.MemoryPressure)
+	}
+
+	// memory.max 为 max 表示不限制
+	stats, err = stat.ReadCgroupStats("testdata/cgroup/v2max")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Version != 2 || stats.MemoryUsage != 1024 || stats.MemoryLimit != 0 {
+		t.Errorf("memory: %+v", stats)
+	}
+}
+
+// 根据 /proc/self/cgroup 读取进程所在的嵌套 cgroup，而不是挂载的根目录
+func Test_ProcessCgroupStats(t *testing.T) {
+	// cpu 所在的 cgroup 不存在时使用挂载的根目录
+	stats, err := stat.ReadProcessCgroupStats("testdata/cgroup/nestedv1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Printf("%+v\n", stats)
+	if stats.Version != 1 || stats.MemoryUsage != 100<<20 || stats.MemoryLimit != 200<<20 {
+		t.Errorf("memory: %+v", stats)
+	}
+	if stats.NrPeriods != 1000 || stats.NrThrottled != 25 {
+		t.Errorf("cpu: %+v", stats)
+	}
+
+	stats, err = stat.ReadProcessCgroupStats("testdata/cgroup/nestedv2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Printf("%+v\n", stats)
+	if stats.Version != 2 || stats.MemoryUsage != 50<<20 || stats.MemoryLimit != 100<<20 {
+		t.Errorf("memory: %+v", stats)
+	}
+	if stats.NrPeriods != 400 || stats.ThrottledTime != 2*time.Second {
+		t.Errorf("cpu: %+v", stats)
+	}
+}
+
+func Test_Collector(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("cpu usage is only available on linux")
+	}
+
+	root := t.TempDir()
+	writeFile := func(name, content string) {
+		file := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 2 核，不限制 cpu quota
+	writeFile("proc/self/cgroup", "4:cpu,cpuacct:/\n3:cpuset:/\n")
+	writeFile("proc/stat", "cpu  0 0 0 0 0 0 0 0 0 0\n")
+	writeFile("sys/fs/cgroup/cpuacct/cpuacct.usage", "0")
+	writeFile("sys/fs/cgroup/cpuacct/cpuacct.usage_percpu", "0 0")
+	writeFile("sys/fs/cgroup/cpuset/cpuset.cpus", "0-1")
+	writeFile("sys/fs/cgroup/cpu/cpu.cfs_quota_us", "-1")
+	writeFile("sys/fs/cgroup/memory/memory.usage_in_bytes", "104857600")
+	writeFile("sys/fs/cgroup/memory/memory.limit_in_bytes", "209715200")
+
+	c := stat.NewCollector(stat.WithRoot(root), stat.WithLogEnabled(false))
+	// 系统 cpu 时间增加 4s（400 ticks），进程 cpu 时间增加 1s，使用率为 1s * 2 核 / (4s * 2 核) = 250m
+	writeFile("proc/stat", "cpu  100 0 100 200 0 0 0 0 0 0\n")
+	writeFile("sys/fs/cgroup/cpuacct/cpuacct.usage", "1000000000")
+	c.Refresh()
+	fmt.Println(c.CpuUsage(), c.MemoryUsage(), c.Cgroup())
+	// 滑动平均：250 * (1 - 0.95)
+	if c.CpuUsage() != 12 {
+		t.Errorf("cpu usage: %d; want 12", c.CpuUsage())
+	}
+	if c.MemoryUsage() != 500 {
+		t.Errorf("memory usage: %d; want 500", c.MemoryUsage())
+	}
+	if c.Cgroup().Version != 1 || c.Cgroup().MemoryLimit != 200<<20 {
+		t.Errorf("cgroup: %+v", c.Cgroup())
+	}
+
+	// 内存限制被移除后使用率归零
+	writeFile("sys/fs/cgroup/memory/memory.limit_in_bytes", "9223372036854771712")
+	c.Refresh()
+	if c.MemoryUsage() != 0 {
+		t.Errorf("memory usage without limit: %d; want 0", c.MemoryUsage())
+	}
+
+	// gc 暂停时间按实际经过的时间计算，与采集间隔无关，占比不会超过 1000m
+	c = stat.NewCollector(stat.WithRoot(root), stat.WithRefreshInterval(time.Nanosecond),
+		stat.WithLogEnabled(false))
+	for i := 0; i < 3; i++ {
+		runtime.GC()
+	}
+	c.Refresh()
+	if pause := c.GcPause(); pause < 0 || pause > 1000 {
+		t.Errorf("gc pause: %d; want in [0, 1000]", pause)
+	}
+
+	// Start 后按采集间隔刷新，Stop 后不再刷新
+	c = stat.NewCollector(stat.WithRoot(root), stat.WithRefreshInterval(time.Millisecond),
+		stat.WithLogEnabled(false))
+	c.Start()
+	c.Start()
+	writeFile("proc/stat", "cpu  200 0 200 400 0 0 0 0 0 0\n")
+	writeFile("sys/fs/cgroup/cpuacct/cpuacct.usage", "2000000000")
+	deadline := time.Now().Add(time.Second)
+	for c.CpuUsage() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	c.Stop()
+	c.Stop()
+	usage := c.CpuUsage()
+	if usage == 0 {
+		t.Fatal("cpu usage is not refreshed after Start")
+	}
+	time.Sleep(10 * time.Millisecond)
+	if c.CpuUsage() != usage {
+		t.Errorf("cpu usage changed after Stop: %d -> %d", usage, c.CpuUsage())
+	}
+}